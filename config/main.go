@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"sync/atomic"
 
 	"gopkg.in/yaml.v3"
 )
@@ -9,28 +10,111 @@ import (
 type FileSystemProvider struct {
 	Name   string `yaml:"name"`
 	Target string `yaml:"target"`
+
+	Connections   int   `yaml:"connections"`
+	SegmentSizeMB int64 `yaml:"segment_size_mb"`
+
+	HedgedRequests bool `yaml:"hedged_requests"`
+
+	RateLimitMbit float64 `yaml:"rate_limit_mbit"`
+
+	HTTP HTTP `yaml:"http"`
+
+	// Overrides the global metadata settings for this file server
+	Metadata Metadata `yaml:"metadata"`
+}
+
+type HTTP struct {
+	CABundle           string `yaml:"ca_bundle"`
+	ClientCertificate  string `yaml:"client_certificate"`
+	ClientKey          string `yaml:"client_key"`
+	InsecureSkipVerify bool   `yaml:"insecure_skip_verify"`
+
+	Proxy string `yaml:"proxy"`
+
+	DialTimeoutSeconds           float64 `yaml:"dial_timeout_seconds"`
+	ResponseHeaderTimeoutSeconds float64 `yaml:"response_header_timeout_seconds"`
+	StallTimeoutSeconds          float64 `yaml:"stall_timeout_seconds"`
+
+	UserAgent string `yaml:"user_agent"`
+}
+
+type Cache struct {
+	ChunkSizeMB  int64 `yaml:"chunk_size_mb"`
+	MemorySizeMB int64 `yaml:"memory_size_mb"`
+	StreamSizeMB int64 `yaml:"stream_size_mb"`
+
+	MemoryCgroupPercent int64 `yaml:"memory_cgroup_percent"`
+	MinStreamSizeMB     int64 `yaml:"min_stream_size_mb"`
+
+	SuspendAfterSeconds int64 `yaml:"suspend_after_seconds"`
+
+	DiskDirectory string `yaml:"disk_directory"`
+	DiskSizeMB    int64  `yaml:"disk_size_mb"`
+}
+
+// Metadata sets how long metadata may be cached by the kernel and in memory,
+// zero uses the default and a negative value disables caching
+type Metadata struct {
+	AttrTTLSeconds     float64 `yaml:"attr_ttl_seconds"`
+	EntryTTLSeconds    float64 `yaml:"entry_ttl_seconds"`
+	NegativeTTLSeconds float64 `yaml:"negative_ttl_seconds"`
+
+	DirectoryTTLSeconds   float64 `yaml:"directory_ttl_seconds"`
+	DirectoryStaleSeconds float64 `yaml:"directory_stale_seconds"`
+}
+
+type Bandwidth struct {
+	RateLimitMbit       float64 `yaml:"rate_limit_mbit"`
+	StreamRateLimitMbit float64 `yaml:"stream_rate_limit_mbit"`
 }
 
 type Config struct {
 	MountPoint  string               `yaml:"mount_point"`
 	VolumeName  string               `yaml:"volume_name"`
 	FileServers []FileSystemProvider `yaml:"file_servers"`
+	Cache       Cache                `yaml:"cache"`
+	Bandwidth   Bandwidth            `yaml:"bandwidth"`
+	Metadata    Metadata             `yaml:"metadata"`
 }
 
+// Last config that could be loaded, used while the file is being edited
+var lastConfig atomic.Pointer[Config]
+
+// get reads the config file, when it can not be read or parsed the last
+// config that could is returned so a half saved file does not take the
+// process down, it only panics when there never was a valid one
 func get() Config {
-	file, err := os.Open("config.yml")
+	cfg, err := Load()
 	if err != nil {
+		if last := lastConfig.Load(); last != nil {
+			return *last
+		}
+
 		panic(err)
 	}
+
+	lastConfig.Store(&cfg)
+
+	return cfg
+}
+
+// Load reads the config file, unlike the getters it returns an error so the
+// config can be reloaded at runtime without taking the process down
+func Load() (Config, error) {
+	file, err := os.Open("config.yml")
+	if err != nil {
+		return Config{}, err
+	}
 	defer file.Close()
 
 	decoder := yaml.NewDecoder(file)
 	var cfg Config
 	if err := decoder.Decode(&cfg); err != nil {
-		panic(err)
+		return Config{}, err
 	}
 
-	return cfg
+	return cfg, nil
 }
 
 func Validate() {
@@ -63,3 +147,53 @@ func GetFileServers() []FileSystemProvider {
 	cfg := get()
 	return cfg.FileServers
 }
+
+func GetFileServer(name string) (FileSystemProvider, bool) {
+	for _, fileServer := range GetFileServers() {
+		if fileServer.Name == name {
+			return fileServer, true
+		}
+	}
+
+	return FileSystemProvider{}, false
+}
+
+func GetCache() Cache {
+	cfg := get()
+	return cfg.Cache
+}
+
+// GetMetadata returns the metadata settings of the file server, the values it
+// does not set are taken from the global settings
+func GetMetadata(name string) Metadata {
+	cfg := get()
+	metadata := cfg.Metadata
+
+	for _, fileServer := range cfg.FileServers {
+		if fileServer.Name != name {
+			continue
+		}
+
+		if fileServer.Metadata.AttrTTLSeconds != 0 {
+			metadata.AttrTTLSeconds = fileServer.Metadata.AttrTTLSeconds
+		}
+
+		if fileServer.Metadata.EntryTTLSeconds != 0 {
+			metadata.EntryTTLSeconds = fileServer.Metadata.EntryTTLSeconds
+		}
+
+		if fileServer.Metadata.NegativeTTLSeconds != 0 {
+			metadata.NegativeTTLSeconds = fileServer.Metadata.NegativeTTLSeconds
+		}
+
+		if fileServer.Metadata.DirectoryTTLSeconds != 0 {
+			metadata.DirectoryTTLSeconds = fileServer.Metadata.DirectoryTTLSeconds
+		}
+
+		if fileServer.Metadata.DirectoryStaleSeconds != 0 {
+			metadata.DirectoryStaleSeconds = fileServer.Metadata.DirectoryStaleSeconds
+		}
+	}
+
+	return metadata
+}
@@ -0,0 +1,106 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"fuse_video_streamer/filesystem/client/interfaces"
+)
+
+type listing struct {
+	nodes   []interfaces.Node
+	fetched time.Time
+
+	refreshing bool
+}
+
+func (listing *listing) isFresh(ttl interfaces.MetadataTTL, now time.Time) bool {
+	return now.Sub(listing.fetched) < ttl.Directory
+}
+
+func (listing *listing) isExpired(ttl interfaces.MetadataTTL, now time.Time) bool {
+	return now.Sub(listing.fetched) >= ttl.Directory+ttl.DirectoryStale
+}
+
+// ReadDirAll serves fresh listings from memory, a stale listing is served as
+// well while it is fetched again in the background
+func (cache *fileSystem) ReadDirAll(ctx context.Context, nodeId uint64) ([]interfaces.Node, error) {
+	if cache.ttl.Directory <= 0 {
+		return cache.FileSystem.ReadDirAll(ctx, nodeId)
+	}
+
+	now := time.Now()
+
+	cache.mu.Lock()
+	listing_, ok := cache.directories[nodeId]
+	if ok && !listing_.isExpired(cache.ttl, now) {
+		if !listing_.isFresh(cache.ttl, now) && !listing_.refreshing {
+			listing_.refreshing = true
+			go cache.refresh(nodeId, listing_)
+		}
+
+		cache.mu.Unlock()
+		return listing_.nodes, nil
+	}
+	generation := cache.generation
+	cache.mu.Unlock()
+
+	nodes, err := cache.FileSystem.ReadDirAll(ctx, nodeId)
+	if err != nil {
+		return nil, err
+	}
+
+	cache.setListing(nodeId, nodes, generation)
+
+	return nodes, nil
+}
+
+// refresh fetches the listing again, the stale one is kept when it fails
+func (cache *fileSystem) refresh(nodeId uint64, stale *listing) {
+	cache.mu.Lock()
+	generation := cache.generation
+	cache.mu.Unlock()
+
+	nodes, err := cache.FileSystem.ReadDirAll(context.Background(), nodeId)
+
+	cache.mu.Lock()
+	stale.refreshing = false
+	cache.mu.Unlock()
+
+	if err != nil {
+		return
+	}
+
+	cache.setListing(nodeId, nodes, generation)
+}
+
+// setListing stores the listing unless a mutation happened since it was
+// requested, the nodes are cached as lookup entries of the directory as well
+func (cache *fileSystem) setListing(nodeId uint64, nodes []interfaces.Node, generation uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.generation != generation {
+		return
+	}
+
+	now := time.Now()
+
+	cache.directories[nodeId] = &listing{
+		nodes:   nodes,
+		fetched: now,
+	}
+
+	if cache.ttl.Entry <= 0 {
+		return
+	}
+
+	for _, node := range nodes {
+		key := entryKey{parentNodeId: nodeId, name: node.GetName()}
+
+		cache.entries[key] = item[interfaces.Node]{
+			value:      node,
+			expiration: now.Add(cache.ttl.Entry),
+		}
+	}
+}
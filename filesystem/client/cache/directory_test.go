@@ -0,0 +1,161 @@
+package cache
+
+import (
+	"context"
+	"testing"
+
+	"fuse_video_streamer/filesystem/client/interfaces"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestDisabledDirectoryTTLDoesNotCache(t *testing.T) {
+	provider := newProvider()
+	cache := newCache(provider, interfaces.MetadataTTL{})
+
+	cache.ReadDirAll(context.Background(), 1)
+	cache.ReadDirAll(context.Background(), 1)
+
+	expectCalls(t, provider, "ReadDirAll", 2)
+}
+
+func TestRemoveInvalidatesListing(t *testing.T) {
+	provider := newProvider()
+	provider.nodes["a"] = &node{id: 2, name: "a"}
+	provider.directories[1] = []interfaces.Node{provider.nodes["a"]}
+	provider.sizes[2] = 100
+
+	cache := newCache(provider, ttl)
+
+	cache.ReadDirAll(context.Background(), 1)
+	cache.GetFileInfo(context.Background(), 2)
+
+	// The listing filled the lookup entries of the directory
+	lookup(t, cache, "a")
+
+	expectCalls(t, provider, "Lookup", 0)
+
+	provider.directories[1] = nil
+	cache.Remove(context.Background(), 1, "a")
+
+	if _, err := lookup(t, cache, "a"); status.Code(err) != codes.NotFound {
+		t.Fatalf("the removed entry is still cached: %v", err)
+	}
+
+	if nodes, _ := cache.ReadDirAll(context.Background(), 1); len(nodes) != 0 {
+		t.Fatalf("the listing still holds the removed entry")
+	}
+
+	cache.GetFileInfo(context.Background(), 2)
+
+	expectCalls(t, provider, "ReadDirAll", 2)
+	expectCalls(t, provider, "GetFileInfo", 2)
+}
+
+func TestListingFetchedDuringMutationIsNotStored(t *testing.T) {
+	provider := newProvider()
+	provider.nodes["a"] = &node{id: 2, name: "a"}
+	provider.directories[1] = []interfaces.Node{provider.nodes["a"]}
+	provider.listingStarted = make(chan struct{})
+	provider.listingRelease = make(chan struct{})
+
+	cache := newCache(provider, ttl)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cache.ReadDirAll(context.Background(), 1)
+	}()
+
+	// The listing was requested before the remove and answers after it
+	<-provider.listingStarted
+	cache.Remove(context.Background(), 1, "a")
+	close(provider.listingRelease)
+	<-done
+
+	provider.listingStarted = nil
+
+	cache.mu.Lock()
+	_, stored := cache.directories[1]
+	cache.mu.Unlock()
+
+	if stored {
+		t.Fatalf("a listing from before the remove was stored")
+	}
+
+	if _, err := lookup(t, cache, "a"); status.Code(err) != codes.NotFound {
+		t.Fatalf("the listing from before the remove cached its entry: %v", err)
+	}
+}
+
+func TestStaleListingIsServedWhileRefreshed(t *testing.T) {
+	provider := newProvider()
+	old := []interfaces.Node{&node{id: 2, name: "a"}}
+	provider.directories[1] = old
+
+	cache := newCache(provider, ttl)
+
+	cache.ReadDirAll(context.Background(), 1)
+
+	provider.mu.Lock()
+	provider.directories[1] = []interfaces.Node{&node{id: 2, name: "a"}, &node{id: 3, name: "b"}}
+	provider.mu.Unlock()
+
+	// A fresh listing is served from memory
+	if nodes, _ := cache.ReadDirAll(context.Background(), 1); len(nodes) != 1 {
+		t.Fatalf("got %d nodes", len(nodes))
+	}
+
+	expectCalls(t, provider, "ReadDirAll", 1)
+
+	age(cache, ttl.Directory)
+
+	// A stale listing is served right away and refreshed in the background
+	if nodes, _ := cache.ReadDirAll(context.Background(), 1); len(nodes) != 1 {
+		t.Fatalf("got %d nodes instead of the stale listing", len(nodes))
+	}
+
+	waitUntil(t, "the stale listing was not refreshed", func() bool {
+		nodes, _ := cache.ReadDirAll(context.Background(), 1)
+		return len(nodes) == 2
+	})
+
+	expectCalls(t, provider, "ReadDirAll", 2)
+
+	// An expired listing is fetched before it is served
+	age(cache, ttl.Directory+ttl.DirectoryStale)
+
+	provider.mu.Lock()
+	provider.directories[1] = old
+	provider.mu.Unlock()
+
+	if nodes, _ := cache.ReadDirAll(context.Background(), 1); len(nodes) != 1 {
+		t.Fatalf("the expired listing was served")
+	}
+
+	expectCalls(t, provider, "ReadDirAll", 3)
+}
+
+func TestFailedRefreshKeepsStaleListing(t *testing.T) {
+	provider := newProvider()
+	provider.directories[1] = []interfaces.Node{&node{id: 2, name: "a"}}
+
+	cache := newCache(provider, ttl)
+
+	cache.ReadDirAll(context.Background(), 1)
+
+	provider.mu.Lock()
+	provider.listingErr = status.Error(codes.Unavailable, "provider is down")
+	provider.mu.Unlock()
+
+	age(cache, ttl.Directory)
+
+	cache.ReadDirAll(context.Background(), 1)
+
+	waitUntil(t, "the stale listing was not refreshed", func() bool { return provider.count("ReadDirAll") >= 2 })
+
+	if nodes, err := cache.ReadDirAll(context.Background(), 1); err != nil || len(nodes) != 1 {
+		t.Fatalf("the stale listing was dropped after the refresh failed: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"syscall"
+	"time"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/filesystem/client/interfaces"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	DefaultAttrTTL     = time.Minute
+	DefaultEntryTTL    = time.Minute
+	DefaultNegativeTTL = 10 * time.Second
+
+	DefaultDirectoryTTL   = 30 * time.Second
+	DefaultDirectoryStale = 5 * time.Minute
+
+	// How often expired items are removed
+	pruneInterval = time.Minute
+)
+
+type item[T any] struct {
+	value      T
+	err        error
+	expiration time.Time
+}
+
+func (item item[T]) isExpired(now time.Time) bool {
+	return !item.expiration.After(now)
+}
+
+type entryKey struct {
+	parentNodeId uint64
+	name         string
+}
+
+// fileSystem caches the metadata and directory listings of the filesystem in
+// front of it, lookups of names that do not exist are remembered as well.
+// Mutations drop what they may have changed.
+type fileSystem struct {
+	interfaces.FileSystem
+
+	ttl interfaces.MetadataTTL
+
+	roots   map[string]item[interfaces.Node]
+	entries map[entryKey]item[interfaces.Node]
+	sizes   map[uint64]item[uint64]
+
+	directories map[uint64]*listing
+
+	// Incremented by every mutation so listings fetched before it are dropped
+	generation uint64
+
+	pruned time.Time
+
+	mu sync.Mutex
+}
+
+var _ interfaces.FileSystem = &fileSystem{}
+
+func New(fileSystem_ interfaces.FileSystem, ttl interfaces.MetadataTTL) interfaces.FileSystem {
+	return &fileSystem{
+		FileSystem: fileSystem_,
+
+		ttl: ttl,
+
+		roots:   make(map[string]item[interfaces.Node]),
+		entries: make(map[entryKey]item[interfaces.Node]),
+		sizes:   make(map[uint64]item[uint64]),
+
+		directories: make(map[uint64]*listing),
+
+		pruned: time.Now(),
+	}
+}
+
+// GetTTL returns the configured metadata TTLs of the file server
+func GetTTL(name string) interfaces.MetadataTTL {
+	metadata := config.GetMetadata(name)
+
+	return interfaces.MetadataTTL{
+		Attr:     ttlOf(metadata.AttrTTLSeconds, DefaultAttrTTL),
+		Entry:    ttlOf(metadata.EntryTTLSeconds, DefaultEntryTTL),
+		Negative: ttlOf(metadata.NegativeTTLSeconds, DefaultNegativeTTL),
+
+		Directory:      ttlOf(metadata.DirectoryTTLSeconds, DefaultDirectoryTTL),
+		DirectoryStale: ttlOf(metadata.DirectoryStaleSeconds, DefaultDirectoryStale),
+	}
+}
+
+func ttlOf(seconds float64, fallback time.Duration) time.Duration {
+	if seconds == 0 {
+		return fallback
+	}
+
+	return max(time.Duration(seconds*float64(time.Second)), 0)
+}
+
+func (cache *fileSystem) Root(ctx context.Context, name string) (interfaces.Node, error) {
+	if root, ok := get(cache, cache.roots, name); ok {
+		return root.value, nil
+	}
+
+	root, err := cache.FileSystem.Root(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	set(cache, cache.roots, name, root, nil, cache.ttl.Entry)
+
+	return root, nil
+}
+
+func (cache *fileSystem) Lookup(ctx context.Context, parentNodeId uint64, name string) (interfaces.Node, error) {
+	key := entryKey{parentNodeId: parentNodeId, name: name}
+
+	if entry, ok := get(cache, cache.entries, key); ok {
+		return entry.value, entry.err
+	}
+
+	node, err := cache.FileSystem.Lookup(ctx, parentNodeId, name)
+
+	switch {
+	case err == nil && node != nil:
+		set(cache, cache.entries, key, node, nil, cache.ttl.Entry)
+	case err == nil || isNotFound(err):
+		set(cache, cache.entries, key, node, err, cache.ttl.Negative)
+	}
+
+	return node, err
+}
+
+func (cache *fileSystem) GetFileInfo(ctx context.Context, nodeId uint64) (uint64, error) {
+	if size, ok := get(cache, cache.sizes, nodeId); ok {
+		return size.value, nil
+	}
+
+	size, err := cache.FileSystem.GetFileInfo(ctx, nodeId)
+	if err != nil {
+		return 0, err
+	}
+
+	set(cache, cache.sizes, nodeId, size, nil, cache.ttl.Attr)
+
+	return size, nil
+}
+
+func (cache *fileSystem) Remove(ctx context.Context, parentNodeId uint64, name string) error {
+	err := cache.FileSystem.Remove(ctx, parentNodeId, name)
+
+	cache.invalidateEntry(parentNodeId, name)
+
+	return err
+}
+
+func (cache *fileSystem) Rename(ctx context.Context, oldParentNodeId uint64, oldName string, newParentNodeId uint64, newName string) error {
+	err := cache.FileSystem.Rename(ctx, oldParentNodeId, oldName, newParentNodeId, newName)
+
+	cache.invalidateEntry(oldParentNodeId, oldName)
+	cache.invalidateEntry(newParentNodeId, newName)
+
+	return err
+}
+
+func (cache *fileSystem) Create(ctx context.Context, parentNodeId uint64, name string, mode fs.FileMode) error {
+	err := cache.FileSystem.Create(ctx, parentNodeId, name, mode)
+
+	cache.invalidateEntry(parentNodeId, name)
+
+	return err
+}
+
+func (cache *fileSystem) MkDir(ctx context.Context, parentNodeId uint64, name string) (interfaces.Node, error) {
+	node, err := cache.FileSystem.MkDir(ctx, parentNodeId, name)
+
+	cache.invalidateEntry(parentNodeId, name)
+
+	return node, err
+}
+
+func (cache *fileSystem) Link(ctx context.Context, parentNodeId uint64, name string, targetNodeId uint64) error {
+	err := cache.FileSystem.Link(ctx, parentNodeId, name, targetNodeId)
+
+	cache.invalidateEntry(parentNodeId, name)
+
+	return err
+}
+
+func (cache *fileSystem) WriteFile(ctx context.Context, nodeId uint64, offset uint64, data []byte) (uint64, error) {
+	written, err := cache.FileSystem.WriteFile(ctx, nodeId, offset, data)
+
+	cache.Invalidate(nodeId)
+
+	return written, err
+}
+
+func (cache *fileSystem) Invalidate(nodeId uint64) {
+	cache.mu.Lock()
+	delete(cache.sizes, nodeId)
+	cache.mu.Unlock()
+
+	cache.FileSystem.Invalidate(nodeId)
+}
+
+// invalidateEntry drops the entry of the name, the size or listing of the
+// node it pointed to and the listing of its directory
+func (cache *fileSystem) invalidateEntry(parentNodeId uint64, name string) {
+	key := entryKey{parentNodeId: parentNodeId, name: name}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.generation++
+	delete(cache.directories, parentNodeId)
+
+	if entry, ok := cache.entries[key]; ok && entry.value != nil {
+		delete(cache.sizes, entry.value.GetId())
+		delete(cache.directories, entry.value.GetId())
+	}
+
+	delete(cache.entries, key)
+}
+
+func get[K comparable, T any](cache *fileSystem, items map[K]item[T], key K) (item[T], bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	item, ok := items[key]
+	if !ok || item.isExpired(time.Now()) {
+		return item, false
+	}
+
+	return item, true
+}
+
+func set[K comparable, T any](cache *fileSystem, items map[K]item[T], key K, value T, err error, ttl time.Duration) {
+	if ttl <= 0 {
+		return
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(cache.pruned) >= pruneInterval {
+		cache.prune(now)
+	}
+
+	items[key] = item[T]{
+		value:      value,
+		err:        err,
+		expiration: now.Add(ttl),
+	}
+}
+
+func (cache *fileSystem) prune(now time.Time) {
+	cache.pruned = now
+
+	deleteExpired(cache.roots, now)
+	deleteExpired(cache.entries, now)
+	deleteExpired(cache.sizes, now)
+
+	for nodeId, listing := range cache.directories {
+		if listing.isExpired(cache.ttl, now) {
+			delete(cache.directories, nodeId)
+		}
+	}
+}
+
+func deleteExpired[K comparable, T any](items map[K]item[T], now time.Time) {
+	for key, item := range items {
+		if item.isExpired(now) {
+			delete(items, key)
+		}
+	}
+}
+
+// isNotFound reports whether the provider answered that the name does not
+// exist, which may be remembered unlike other failures
+func isNotFound(err error) bool {
+	if errors.Is(err, syscall.ENOENT) {
+		return true
+	}
+
+	return status.Code(err) == codes.NotFound
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/filesystem/client/interfaces"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type node struct {
+	id   uint64
+	name string
+}
+
+func (node *node) GetId() uint64        { return node.id }
+func (node *node) GetName() string      { return node.name }
+func (node *node) GetMode() fs.FileMode { return 0644 }
+func (node *node) GetStreamable() bool  { return false }
+
+// provider is a filesystem that counts its calls, only the methods the
+// tests use are implemented
+type provider struct {
+	interfaces.FileSystem
+
+	nodes       map[string]interfaces.Node
+	directories map[uint64][]interfaces.Node
+	sizes       map[uint64]uint64
+
+	lookupErr  error
+	listingErr error
+
+	// Listings wait for it when set, so a mutation can happen meanwhile
+	listingStarted chan struct{}
+	listingRelease chan struct{}
+
+	calls map[string]int
+
+	mu sync.Mutex
+}
+
+func newProvider() *provider {
+	return &provider{
+		nodes:       make(map[string]interfaces.Node),
+		directories: make(map[uint64][]interfaces.Node),
+		sizes:       make(map[uint64]uint64),
+		calls:       make(map[string]int),
+	}
+}
+
+func (provider *provider) call(name string) {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	provider.calls[name]++
+}
+
+func (provider *provider) count(name string) int {
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	return provider.calls[name]
+}
+
+func (provider *provider) Lookup(ctx context.Context, parentNodeId uint64, name string) (interfaces.Node, error) {
+	provider.call("Lookup")
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.lookupErr != nil {
+		return nil, provider.lookupErr
+	}
+
+	node, ok := provider.nodes[name]
+	if !ok {
+		return nil, status.Error(codes.NotFound, name)
+	}
+
+	return node, nil
+}
+
+func (provider *provider) ReadDirAll(ctx context.Context, nodeId uint64) ([]interfaces.Node, error) {
+	provider.call("ReadDirAll")
+
+	if provider.listingStarted != nil {
+		provider.listingStarted <- struct{}{}
+		<-provider.listingRelease
+	}
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	if provider.listingErr != nil {
+		return nil, provider.listingErr
+	}
+
+	return provider.directories[nodeId], nil
+}
+
+func (provider *provider) GetFileInfo(ctx context.Context, nodeId uint64) (uint64, error) {
+	provider.call("GetFileInfo")
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	return provider.sizes[nodeId], nil
+}
+
+func (provider *provider) Remove(ctx context.Context, parentNodeId uint64, name string) error {
+	provider.call("Remove")
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	delete(provider.nodes, name)
+
+	return nil
+}
+
+func (provider *provider) WriteFile(ctx context.Context, nodeId uint64, offset uint64, data []byte) (uint64, error) {
+	provider.call("WriteFile")
+
+	provider.mu.Lock()
+	defer provider.mu.Unlock()
+
+	provider.sizes[nodeId] = offset + uint64(len(data))
+
+	return uint64(len(data)), nil
+}
+
+func (provider *provider) Invalidate(nodeId uint64) {}
+
+var ttl = interfaces.MetadataTTL{
+	Attr:     time.Minute,
+	Entry:    time.Minute,
+	Negative: 10 * time.Second,
+
+	Directory:      30 * time.Second,
+	DirectoryStale: 5 * time.Minute,
+}
+
+func newCache(provider *provider, ttl interfaces.MetadataTTL) *fileSystem {
+	return New(provider, ttl).(*fileSystem)
+}
+
+// age moves everything the cache holds the duration into the past
+func age(cache *fileSystem, duration time.Duration) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for key, item := range cache.entries {
+		item.expiration = item.expiration.Add(-duration)
+		cache.entries[key] = item
+	}
+
+	for key, item := range cache.sizes {
+		item.expiration = item.expiration.Add(-duration)
+		cache.sizes[key] = item
+	}
+
+	for _, listing := range cache.directories {
+		listing.fetched = listing.fetched.Add(-duration)
+	}
+}
+
+func expectCalls(t *testing.T, provider *provider, name string, expected int) {
+	t.Helper()
+
+	if count := provider.count(name); count != expected {
+		t.Fatalf("%s was called %d times, expected %d", name, count, expected)
+	}
+}
+
+// waitUntil polls the condition and fails the test once it did not hold in time
+func waitUntil(t *testing.T, message string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func lookup(t *testing.T, cache *fileSystem, name string) (interfaces.Node, error) {
+	t.Helper()
+
+	return cache.Lookup(context.Background(), 1, name)
+}
+
+func TestLookupIsCachedForEntryTTL(t *testing.T) {
+	provider := newProvider()
+	provider.nodes["a"] = &node{id: 2, name: "a"}
+
+	cache := newCache(provider, ttl)
+
+	for range 3 {
+		if node, err := lookup(t, cache, "a"); err != nil || node.GetId() != 2 {
+			t.Fatalf("got %v: %v", node, err)
+		}
+	}
+
+	expectCalls(t, provider, "Lookup", 1)
+
+	age(cache, ttl.Entry)
+	lookup(t, cache, "a")
+
+	expectCalls(t, provider, "Lookup", 2)
+}
+
+func TestNegativeLookupIsCachedForNegativeTTL(t *testing.T) {
+	provider := newProvider()
+	cache := newCache(provider, ttl)
+
+	for range 3 {
+		if _, err := lookup(t, cache, "missing"); status.Code(err) != codes.NotFound {
+			t.Fatalf("expected not found, got %v", err)
+		}
+	}
+
+	expectCalls(t, provider, "Lookup", 1)
+
+	// The name is found once the negative entry expired
+	provider.nodes["missing"] = &node{id: 3, name: "missing"}
+
+	age(cache, ttl.Negative)
+
+	if node, err := lookup(t, cache, "missing"); err != nil || node.GetId() != 3 {
+		t.Fatalf("got %v: %v", node, err)
+	}
+}
+
+func TestFailedLookupIsNotCached(t *testing.T) {
+	provider := newProvider()
+	provider.lookupErr = status.Error(codes.Unavailable, "provider is down")
+
+	cache := newCache(provider, ttl)
+
+	lookup(t, cache, "a")
+	lookup(t, cache, "a")
+
+	expectCalls(t, provider, "Lookup", 2)
+
+	if !isNotFound(syscall.ENOENT) || isNotFound(errors.New("timeout")) {
+		t.Fatalf("ENOENT and other errors are told apart wrong")
+	}
+}
+
+func TestDisabledTTLsDoNotCache(t *testing.T) {
+	provider := newProvider()
+	provider.nodes["a"] = &node{id: 2, name: "a"}
+
+	cache := newCache(provider, interfaces.MetadataTTL{})
+
+	lookup(t, cache, "a")
+	lookup(t, cache, "a")
+	lookup(t, cache, "missing")
+	lookup(t, cache, "missing")
+	cache.GetFileInfo(context.Background(), 2)
+	cache.GetFileInfo(context.Background(), 2)
+
+	expectCalls(t, provider, "Lookup", 4)
+	expectCalls(t, provider, "GetFileInfo", 2)
+}
+
+func TestFileInfoIsCachedUntilWritten(t *testing.T) {
+	provider := newProvider()
+	provider.sizes[2] = 100
+
+	cache := newCache(provider, ttl)
+
+	cache.GetFileInfo(context.Background(), 2)
+
+	if size, _ := cache.GetFileInfo(context.Background(), 2); size != 100 {
+		t.Fatalf("got size %d", size)
+	}
+
+	expectCalls(t, provider, "GetFileInfo", 1)
+
+	cache.WriteFile(context.Background(), 2, 100, make([]byte, 50))
+
+	if size, _ := cache.GetFileInfo(context.Background(), 2); size != 150 {
+		t.Fatalf("got size %d after the write", size)
+	}
+
+	age(cache, ttl.Attr)
+	cache.GetFileInfo(context.Background(), 2)
+
+	expectCalls(t, provider, "GetFileInfo", 3)
+}
+
+func TestRemoveInvalidatesEntry(t *testing.T) {
+	provider := newProvider()
+	provider.nodes["a"] = &node{id: 2, name: "a"}
+	provider.sizes[2] = 100
+
+	cache := newCache(provider, ttl)
+
+	lookup(t, cache, "a")
+	cache.GetFileInfo(context.Background(), 2)
+
+	cache.Remove(context.Background(), 1, "a")
+
+	if _, err := lookup(t, cache, "a"); status.Code(err) != codes.NotFound {
+		t.Fatalf("the removed entry is still cached: %v", err)
+	}
+
+	cache.GetFileInfo(context.Background(), 2)
+
+	expectCalls(t, provider, "Lookup", 2)
+	expectCalls(t, provider, "GetFileInfo", 2)
+}
@@ -1,9 +1,15 @@
 package interfaces
 
 import (
+	"context"
+	"errors"
 	"io/fs"
+	"time"
 )
 
+// ErrClientNotFound is returned when no client has the requested name
+var ErrClientNotFound = errors.New("client not found")
+
 type ClientRepository interface {
 	GetClientByName(name string) (Client, error)
 	GetClients() ([]Client, error)
@@ -12,25 +18,64 @@ type ClientRepository interface {
 type Client interface {
 	GetName() string
 	GetFileSystem() FileSystem
+	GetMetadataTTL() MetadataTTL
+}
+
+// MetadataTTL is how long metadata of a client may be cached, zero disables
+// caching
+type MetadataTTL struct {
+	Attr  time.Duration
+	Entry time.Duration
+
+	// How long a name that was not found is remembered
+	Negative time.Duration
+
+	// How long a directory listing is fresh and how long after that it is
+	// still served while it is refreshed in the background
+	Directory      time.Duration
+	DirectoryStale time.Duration
 }
 
 type FileSystem interface {
-	Root(name string) (Node, error)
-	ReadDirAll(nodeId uint64) ([]Node, error)
-	Lookup(parentNodeId uint64, name string) (Node, error)
-	Remove(parentNodeId uint64, name string) error
-	Rename(oldParentNodeId uint64, oldName string, newParentNodeId uint64, newName string) error
-	Create(parentNodeId uint64, name string, mode fs.FileMode) error
-	MkDir(parentNodeId uint64, name string) (Node, error)
-	Link(parentNodeId uint64, name string, targetNodeId uint64) error
-
-	ReadLink(nodeId uint64) (string, error)
-
-	ReadFile(nodeId uint64, offset uint64, size uint64) ([]byte, error)
-	WriteFile(nodeId uint64, offset uint64, data []byte) (uint64, error)
-
-	GetFileInfo(nodeId uint64) (size uint64, error error)
-	GetStreamUrl(nodeId uint64) (url string, error error)
+	Root(ctx context.Context, name string) (Node, error)
+	ReadDirAll(ctx context.Context, nodeId uint64) ([]Node, error)
+	Lookup(ctx context.Context, parentNodeId uint64, name string) (Node, error)
+	Remove(ctx context.Context, parentNodeId uint64, name string) error
+	Rename(ctx context.Context, oldParentNodeId uint64, oldName string, newParentNodeId uint64, newName string) error
+	Create(ctx context.Context, parentNodeId uint64, name string, mode fs.FileMode) error
+	MkDir(ctx context.Context, parentNodeId uint64, name string) (Node, error)
+	Link(ctx context.Context, parentNodeId uint64, name string, targetNodeId uint64) error
+
+	ReadLink(ctx context.Context, nodeId uint64) (string, error)
+
+	ReadFile(ctx context.Context, nodeId uint64, offset uint64, size uint64) ([]byte, error)
+	WriteFile(ctx context.Context, nodeId uint64, offset uint64, data []byte) (uint64, error)
+
+	GetFileInfo(ctx context.Context, nodeId uint64) (size uint64, error error)
+	GetStreamUrl(ctx context.Context, nodeId uint64) (url string, error error)
+	GetStreamDescriptor(ctx context.Context, nodeId uint64) (*StreamDescriptor, error)
+
+	// Invalidate drops the cached metadata of the node
+	Invalidate(nodeId uint64)
+}
+
+// StreamDescriptor describes where and how the content of a node can be
+// streamed, providers that only know a url describe a single source.
+// Providers send it JSON encoded in the url of GetStreamUrl, the JSON field
+// names must not change.
+type StreamDescriptor struct {
+	Sources []StreamSource `json:"sources"`
+
+	// Zero when the provider does not know when the urls expire
+	ExpiresAt time.Time `json:"expires_at"`
+
+	Size int64  `json:"size"`
+	ETag string `json:"etag"`
+}
+
+type StreamSource struct {
+	Url     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
 }
 
 type Node interface {
@@ -0,0 +1,71 @@
+package filesystem
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"fuse_video_streamer/filesystem/client/interfaces"
+
+	api "github.com/sushydev/stream_mount_api"
+)
+
+// The stream api has no field for a descriptor, so GetStreamUrlResponse.url
+// carries one of two encodings:
+//
+//   - a plain url, the only source of the stream
+//   - a JSON encoded interfaces.StreamDescriptor, recognised by "{" as the
+//     first character after leading whitespace
+//
+// The JSON field names of interfaces.StreamDescriptor are part of the api,
+// expires_at is an RFC 3339 time. Mounts that predate descriptors use the
+// whole value as url, providers serving them have to send plain urls.
+
+// GetStreamDescriptor returns the descriptor of the stream, providers send
+// either a plain url or a JSON encoded descriptor in the url field
+func (fs *filesystem) GetStreamDescriptor(ctx context.Context, nodeId uint64) (*interfaces.StreamDescriptor, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
+	defer cancel()
+
+	response, err := fs.api.GetStreamUrl(requestCtx, &api.GetStreamUrlRequest{
+		NodeId: nodeId,
+	})
+
+	if err != nil {
+		return nil, api.FromResponseError(err)
+	}
+
+	return parseStreamDescriptor(response.GetUrl())
+}
+
+func parseStreamDescriptor(value string) (*interfaces.StreamDescriptor, error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.HasPrefix(value, "{") {
+		descriptor := &interfaces.StreamDescriptor{
+			Sources: []interfaces.StreamSource{{Url: value}},
+		}
+
+		return descriptor, nil
+	}
+
+	var descriptor interfaces.StreamDescriptor
+
+	err := json.Unmarshal([]byte(value), &descriptor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid stream descriptor: %w", err)
+	}
+
+	if len(descriptor.Sources) == 0 {
+		return nil, fmt.Errorf("stream descriptor has no sources")
+	}
+
+	for _, source := range descriptor.Sources {
+		if source.Url == "" {
+			return nil, fmt.Errorf("stream descriptor has a source without url")
+		}
+	}
+
+	return &descriptor, nil
+}
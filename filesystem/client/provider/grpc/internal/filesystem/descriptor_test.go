@@ -0,0 +1,78 @@
+package filesystem
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePlainUrl(t *testing.T) {
+	descriptor, err := parseStreamDescriptor(" https://cdn.example.com/file.mkv\n")
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if len(descriptor.Sources) != 1 || descriptor.Sources[0].Url != "https://cdn.example.com/file.mkv" {
+		t.Fatalf("got sources %+v", descriptor.Sources)
+	}
+
+	if !descriptor.ExpiresAt.IsZero() || descriptor.Size != 0 || descriptor.ETag != "" {
+		t.Fatalf("plain url has metadata %+v", descriptor)
+	}
+}
+
+// TestParseDescriptor pins the JSON encoding providers send in the url field
+func TestParseDescriptor(t *testing.T) {
+	value := `
+	{
+		"sources": [
+			{"url": "https://a.example.com/file.mkv", "headers": {"Authorization": "Bearer token"}},
+			{"url": "https://b.example.com/file.mkv"}
+		],
+		"expires_at": "2025-01-01T12:00:00Z",
+		"size": 1234567890,
+		"etag": "\"abc\""
+	}`
+
+	descriptor, err := parseStreamDescriptor(value)
+	if err != nil {
+		t.Fatalf("failed to parse: %v", err)
+	}
+
+	if len(descriptor.Sources) != 2 {
+		t.Fatalf("got sources %+v", descriptor.Sources)
+	}
+
+	if descriptor.Sources[0].Url != "https://a.example.com/file.mkv" || descriptor.Sources[0].Headers["Authorization"] != "Bearer token" {
+		t.Fatalf("got first source %+v", descriptor.Sources[0])
+	}
+
+	if descriptor.Sources[1].Url != "https://b.example.com/file.mkv" || len(descriptor.Sources[1].Headers) != 0 {
+		t.Fatalf("got second source %+v", descriptor.Sources[1])
+	}
+
+	if !descriptor.ExpiresAt.Equal(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)) {
+		t.Fatalf("got expiry %s", descriptor.ExpiresAt)
+	}
+
+	if descriptor.Size != 1234567890 || descriptor.ETag != `"abc"` {
+		t.Fatalf("got size %d and etag %s", descriptor.Size, descriptor.ETag)
+	}
+}
+
+func TestParseInvalidDescriptor(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{name: "invalid JSON", value: `{"sources": [`},
+		{name: "no sources", value: `{"size": 10}`},
+		{name: "source without url", value: `{"sources": [{"headers": {"Cookie": "a=b"}}]}`},
+		{name: "expiry that is not RFC 3339", value: `{"sources": [{"url": "https://a.example.com"}], "expires_at": "tomorrow"}`},
+	}
+
+	for _, test := range tests {
+		if descriptor, err := parseStreamDescriptor(test.value); err == nil {
+			t.Errorf("%s: expected an error, got %+v", test.name, descriptor)
+		}
+	}
+}
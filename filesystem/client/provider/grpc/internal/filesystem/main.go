@@ -12,6 +12,8 @@ import (
 	api "github.com/sushydev/stream_mount_api"
 )
 
+const requestTimeout = 10 * time.Second
+
 type filesystem struct {
 	api api.FileSystemServiceClient
 
@@ -70,8 +72,20 @@ func New(api api.FileSystemServiceClient, logger *logger.Logger) *filesystem {
 	}
 }
 
-func (fs *filesystem) Root(name string) (interfaces.Node, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+// requestContext bounds a call by the context of the request, a timeout and
+// the lifetime of the filesystem
+func (fs *filesystem) requestContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	requestCtx, cancel := context.WithTimeout(ctx, requestTimeout)
+	stop := context.AfterFunc(fs.ctx, cancel)
+
+	return requestCtx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (fs *filesystem) Root(ctx context.Context, name string) (interfaces.Node, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.Root(requestCtx, &api.RootRequest{})
@@ -89,8 +103,8 @@ func (fs *filesystem) Root(name string) (interfaces.Node, error) {
 	), nil
 }
 
-func (fs *filesystem) ReadDirAll(nodeId uint64) ([]interfaces.Node, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) ReadDirAll(ctx context.Context, nodeId uint64) ([]interfaces.Node, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.ReadDirAll(requestCtx, &api.ReadDirAllRequest{
@@ -117,8 +131,8 @@ func (fs *filesystem) ReadDirAll(nodeId uint64) ([]interfaces.Node, error) {
 
 }
 
-func (fs *filesystem) Lookup(parentNodeId uint64, name string) (interfaces.Node, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) Lookup(ctx context.Context, parentNodeId uint64, name string) (interfaces.Node, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.Lookup(requestCtx, &api.LookupRequest{
@@ -140,8 +154,8 @@ func (fs *filesystem) Lookup(parentNodeId uint64, name string) (interfaces.Node,
 	), nil
 }
 
-func (fs *filesystem) Remove(parentNodeId uint64, name string) error {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) Remove(ctx context.Context, parentNodeId uint64, name string) error {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	_, err := fs.api.Remove(requestCtx, &api.RemoveRequest{
@@ -152,8 +166,8 @@ func (fs *filesystem) Remove(parentNodeId uint64, name string) error {
 	return api.FromResponseError(err)
 }
 
-func (fs *filesystem) Rename(oldParentNodeId uint64, oldName string, newParentNodeId uint64, newName string) error {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) Rename(ctx context.Context, oldParentNodeId uint64, oldName string, newParentNodeId uint64, newName string) error {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	_, err := fs.api.Rename(requestCtx, &api.RenameRequest{
@@ -166,8 +180,8 @@ func (fs *filesystem) Rename(oldParentNodeId uint64, oldName string, newParentNo
 	return api.FromResponseError(err)
 }
 
-func (fs *filesystem) Create(parentNodeId uint64, name string, mode io_fs.FileMode) error {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) Create(ctx context.Context, parentNodeId uint64, name string, mode io_fs.FileMode) error {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	_, err := fs.api.Create(requestCtx, &api.CreateRequest{
@@ -179,8 +193,8 @@ func (fs *filesystem) Create(parentNodeId uint64, name string, mode io_fs.FileMo
 	return api.FromResponseError(err)
 }
 
-func (fs *filesystem) MkDir(parentNodeId uint64, name string) (interfaces.Node, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) MkDir(ctx context.Context, parentNodeId uint64, name string) (interfaces.Node, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	fmt.Println("Creating directory:", name, "under parent node ID:", parentNodeId)
@@ -203,8 +217,8 @@ func (fs *filesystem) MkDir(parentNodeId uint64, name string) (interfaces.Node,
 }
 
 
-func (fs *filesystem) Link(parentNodeId uint64, name string, targetNodeId uint64) error {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) Link(ctx context.Context, parentNodeId uint64, name string, targetNodeId uint64) error {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	_, err := fs.api.Link(requestCtx, &api.LinkRequest{
@@ -216,8 +230,8 @@ func (fs *filesystem) Link(parentNodeId uint64, name string, targetNodeId uint64
 	return api.FromResponseError(err)
 }
 
-func (fs *filesystem) ReadLink(nodeId uint64) (string, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) ReadLink(ctx context.Context, nodeId uint64) (string, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.ReadLink(requestCtx, &api.ReadLinkRequest{
@@ -231,8 +245,8 @@ func (fs *filesystem) ReadLink(nodeId uint64) (string, error) {
 	return response.GetPath(), nil
 }
 
-func (fs *filesystem) GetFileInfo(nodeId uint64) (uint64, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) GetFileInfo(ctx context.Context, nodeId uint64) (uint64, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.GetFileInfo(requestCtx, &api.GetFileInfoRequest{
@@ -246,23 +260,17 @@ func (fs *filesystem) GetFileInfo(nodeId uint64) (uint64, error) {
 	return response.GetSize(), nil
 }
 
-func (fs *filesystem) GetStreamUrl(nodeId uint64) (string, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
-	defer cancel()
-
-	response, err := fs.api.GetStreamUrl(requestCtx, &api.GetStreamUrlRequest{
-		NodeId: nodeId,
-	})
-
+func (fs *filesystem) GetStreamUrl(ctx context.Context, nodeId uint64) (string, error) {
+	descriptor, err := fs.GetStreamDescriptor(ctx, nodeId)
 	if err != nil {
-		return "", api.FromResponseError(err)
+		return "", err
 	}
 
-	return response.GetUrl(), nil
+	return descriptor.Sources[0].Url, nil
 }
 
-func (fs *filesystem) ReadFile(nodeId uint64, offset uint64, size uint64) ([]byte, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) ReadFile(ctx context.Context, nodeId uint64, offset uint64, size uint64) ([]byte, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.ReadFile(requestCtx, &api.ReadFileRequest{
@@ -278,8 +286,8 @@ func (fs *filesystem) ReadFile(nodeId uint64, offset uint64, size uint64) ([]byt
 	return response.GetData(), nil
 }
 
-func (fs *filesystem) WriteFile(nodeId uint64, offset uint64, data []byte) (uint64, error) {
-	requestCtx, cancel := context.WithTimeout(fs.ctx, 10*time.Second)
+func (fs *filesystem) WriteFile(ctx context.Context, nodeId uint64, offset uint64, data []byte) (uint64, error) {
+	requestCtx, cancel := fs.requestContext(ctx)
 	defer cancel()
 
 	response, err := fs.api.WriteFile(requestCtx, &api.WriteFileRequest{
@@ -294,3 +302,6 @@ func (fs *filesystem) WriteFile(nodeId uint64, offset uint64, data []byte) (uint
 
 	return response.GetBytesWritten(), nil
 }
+
+// Invalidate does nothing, every call is sent to the provider
+func (fs *filesystem) Invalidate(nodeId uint64) {}
@@ -5,6 +5,7 @@ import (
 
 	"fuse_video_streamer/config"
 	"fuse_video_streamer/logger"
+	"fuse_video_streamer/filesystem/client/cache"
 	"fuse_video_streamer/filesystem/client/interfaces"
 	"fuse_video_streamer/filesystem/client/provider/grpc/internal/filesystem"
 
@@ -20,6 +21,7 @@ type provider struct{
 	name string
 	target string
 	fileSystem interfaces.FileSystem
+	ttl interfaces.MetadataTTL
 }
 
 var _ interfaces.Client = &provider{}
@@ -55,7 +57,8 @@ func New(entry config.FileSystemProvider) (interfaces.Client, error) {
 		return nil, err
 	}
 
-	fileSystem := filesystem.New(client, logger)
+	ttl := cache.GetTTL(entry.Name)
+	fileSystem := cache.New(filesystem.New(client, logger), ttl)
 
 	// TODO healthcheck endpoint
 	logger.Info(fmt.Sprintf("Connected to file system provider:	%s", entry.Name))
@@ -64,6 +67,7 @@ func New(entry config.FileSystemProvider) (interfaces.Client, error) {
 		name: entry.Name,
 		target: entry.Target,
 		fileSystem: fileSystem,
+		ttl: ttl,
 	}, nil
 }
 
@@ -74,3 +78,7 @@ func (p *provider) GetName() string {
 func (p *provider) GetFileSystem() interfaces.FileSystem {
 	return p.fileSystem
 }
+
+func (p *provider) GetMetadataTTL() interfaces.MetadataTTL {
+	return p.ttl
+}
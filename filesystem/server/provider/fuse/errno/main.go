@@ -0,0 +1,151 @@
+package errno
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"syscall"
+
+	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream"
+	"fuse_video_streamer/stream/connection"
+	"fuse_video_streamer/stream/memory"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// FromError classifies an error of a provider or stream into the errno that
+// is returned to the kernel, errors of interrupted requests become EINTR and
+// everything that cannot be classified becomes EIO
+func FromError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return syscall.EINTR
+	}
+
+	return classify(err, false)
+}
+
+// FromWriteError classifies like FromError, providers that do not implement
+// an operation that modifies the tree are read-only which becomes EROFS
+func FromWriteError(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if ctx.Err() != nil {
+		return syscall.EINTR
+	}
+
+	return classify(err, true)
+}
+
+// Report logs the error unless the request was interrupted or the error is
+// an expected one like a missing entry and returns its errno
+func Report(ctx context.Context, logger *logger.Logger, message string, err error) error {
+	errno := FromError(ctx, err)
+
+	return report(logger, message, err, errno)
+}
+
+// ReportWrite is Report for operations that modify the tree
+func ReportWrite(ctx context.Context, logger *logger.Logger, message string, err error) error {
+	errno := FromWriteError(ctx, err)
+
+	return report(logger, message, err, errno)
+}
+
+func report(logger *logger.Logger, message string, err error, errno error) error {
+	switch errno {
+	case syscall.EINTR, syscall.ENOENT:
+	default:
+		logger.Error(message, err)
+	}
+
+	return errno
+}
+
+func classify(err error, write bool) error {
+	var errno syscall.Errno
+	if errors.As(err, &errno) {
+		return errno
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return syscall.EINTR
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, stream.ErrTimeout):
+		return syscall.ETIMEDOUT
+	case errors.Is(err, filesystem_client_interfaces.ErrClientNotFound):
+		return syscall.ENOENT
+	case errors.Is(err, memory.ErrExhausted):
+		return syscall.ENOMEM
+	}
+
+	var changedError *connection.ChangedError
+	if errors.As(err, &changedError) {
+		return syscall.ESTALE
+	}
+
+	var statusError *connection.StatusError
+	if errors.As(err, &statusError) {
+		return fromHttpStatus(statusError.StatusCode)
+	}
+
+	if grpcStatus, ok := status.FromError(err); ok {
+		return fromCode(grpcStatus.Code(), write)
+	}
+
+	var netError net.Error
+	if errors.As(err, &netError) && netError.Timeout() {
+		return syscall.ETIMEDOUT
+	}
+
+	return syscall.EIO
+}
+
+func fromCode(code codes.Code, write bool) error {
+	switch code {
+	case codes.NotFound:
+		return syscall.ENOENT
+	case codes.AlreadyExists:
+		return syscall.EEXIST
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return syscall.EACCES
+	case codes.InvalidArgument, codes.OutOfRange:
+		return syscall.EINVAL
+	case codes.DeadlineExceeded:
+		return syscall.ETIMEDOUT
+	case codes.Canceled:
+		return syscall.EINTR
+	case codes.Unimplemented:
+		if write {
+			return syscall.EROFS
+		}
+
+		return syscall.ENOTSUP
+	default:
+		return syscall.EIO
+	}
+}
+
+func fromHttpStatus(statusCode int) error {
+	switch statusCode {
+	case http.StatusNotFound, http.StatusGone:
+		return syscall.ENOENT
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusProxyAuthRequired:
+		return syscall.EACCES
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return syscall.ETIMEDOUT
+	case http.StatusNotImplemented:
+		return syscall.ENOTSUP
+	default:
+		return syscall.EIO
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
 	"fuse_video_streamer/logger"
 
@@ -62,11 +63,14 @@ func (handle *Handle) ReadDirAll(ctx context.Context) ([]fuse.Dirent, error) {
 
 	fileSystem := handle.client.GetFileSystem()
 
-	nodes, err := fileSystem.ReadDirAll(handle.directory.GetIdentifier())
-	if err != nil && err != syscall.ENOENT {
+	nodes, err := fileSystem.ReadDirAll(ctx, handle.directory.GetIdentifier())
+	if err != nil {
 		message := fmt.Sprintf("Failed to read directory %d", handle.directory.GetIdentifier())
-		handle.logger.Error(message, err)
-		return nil, err
+
+		// A directory that is gone is listed as empty
+		if err := errno.Report(ctx, handle.logger, message, err); err != syscall.ENOENT {
+			return nil, err
+		}
 	}
 
 	var entries []fuse.Dirent
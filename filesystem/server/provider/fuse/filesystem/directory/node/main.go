@@ -10,6 +10,7 @@ import (
 	"syscall"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	directory_handle_service_factory "fuse_video_streamer/filesystem/server/provider/fuse/filesystem/directory/handle/service/factory"
 	"fuse_video_streamer/filesystem/server/provider/fuse/filesystem/symlink"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
@@ -84,6 +85,7 @@ func (node *Node) Attr(ctx context.Context, attr *fuse.Attr) error {
 	}
 
 	attr.Mode = os.ModeDir
+	attr.Valid = node.client.GetMetadataTTL().Attr
 
 	return nil
 }
@@ -118,28 +120,26 @@ func (node *Node) Lookup(ctx context.Context, lookupRequest *fuse.LookupRequest,
 
 	remote_filesystem := node.client.GetFileSystem()
 
-	foundNode, err := remote_filesystem.Lookup(node.GetIdentifier(), lookupRequest.Name)
-
-	if err == syscall.ENOENT {
-		return nil, syscall.ENOENT
-	} else if err != nil {
-		node.logger.Error(fmt.Sprintf("Failed to lookup node: %s in directory with ID: %d", lookupRequest.Name, node.GetIdentifier()), err)
-
-		return nil, syscall.EAGAIN
+	foundNode, err := remote_filesystem.Lookup(ctx, node.GetIdentifier(), lookupRequest.Name)
+	if err != nil {
+		message := fmt.Sprintf("Failed to lookup node: %s in directory with ID: %d", lookupRequest.Name, node.GetIdentifier())
+		return nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	if foundNode == nil {
 		return nil, syscall.ENOENT
 	}
 
+	lookupResponse.EntryValid = node.client.GetMetadataTTL().Entry
+
 	switch foundNode.GetMode() {
 	case io_fs.ModeDir:
 		return node.directoryNodeService.New(foundNode.GetId())
 	case io_fs.FileMode(0):
 		if foundNode.GetStreamable() {
-			return node.streamableNodeService.New(foundNode.GetId())
+			return node.streamableNodeService.New(ctx, foundNode.GetId())
 		} else {
-			return node.fileNodeService.New(foundNode.GetId())
+			return node.fileNodeService.New(ctx, foundNode.GetId())
 		}
 	case io_fs.ModeSymlink:
 		return symlink.New(node.client, foundNode.GetId()), nil
@@ -160,11 +160,10 @@ func (node *Node) Remove(ctx context.Context, removeRequest *fuse.RemoveRequest)
 
 	fileSystem := node.client.GetFileSystem()
 
-	err := fileSystem.Remove(node.identifier, removeRequest.Name)
+	err := fileSystem.Remove(ctx, node.identifier, removeRequest.Name)
 	if err != nil {
 		message := fmt.Sprintf("Failed to remove %s", removeRequest.Name)
-		node.logger.Error(message, err)
-		return err
+		return errno.ReportWrite(ctx, node.logger, message, err)
 	}
 
 	return nil
@@ -185,11 +184,10 @@ func (node *Node) Rename(ctx context.Context, request *fuse.RenameRequest, newDi
 
 	fileSystem := node.client.GetFileSystem()
 
-	err := fileSystem.Rename(node.GetIdentifier(), request.OldName, newDirectory.GetIdentifier(), request.NewName)
+	err := fileSystem.Rename(ctx, node.GetIdentifier(), request.OldName, newDirectory.GetIdentifier(), request.NewName)
 	if err != nil {
 		message := fmt.Sprintf("Failed to rename %s to %s", request.OldName, request.NewName)
-		node.logger.Error(message, err)
-		return err
+		return errno.ReportWrite(ctx, node.logger, message, err)
 	}
 
 	return nil
@@ -205,32 +203,28 @@ func (node *Node) Create(ctx context.Context, request *fuse.CreateRequest, respo
 
 	fileSystem := node.client.GetFileSystem()
 
-	err := fileSystem.Create(node.GetIdentifier(), request.Name, io_fs.FileMode(request.Mode))
+	err := fileSystem.Create(ctx, node.GetIdentifier(), request.Name, io_fs.FileMode(request.Mode))
 	if err != nil {
 		message := fmt.Sprintf("Failed to create %s", request.Name)
-		node.logger.Error(message, err)
-		return nil, nil, err
+		return nil, nil, errno.ReportWrite(ctx, node.logger, message, err)
 	}
 
-	foundNode, err := fileSystem.Lookup(node.GetIdentifier(), request.Name)
+	foundNode, err := fileSystem.Lookup(ctx, node.GetIdentifier(), request.Name)
 	if err != nil {
 		message := fmt.Sprintf("Failed to lookup %s", request.Name)
-		node.logger.Error(message, err)
-		return nil, nil, err
+		return nil, nil, errno.Report(ctx, node.logger, message, err)
 	}
 
-	fileNode, err := node.fileNodeService.New(foundNode.GetId())
+	fileNode, err := node.fileNodeService.New(ctx, foundNode.GetId())
 	if err != nil {
 		message := fmt.Sprintf("Failed to create file node %s", request.Name)
-		node.logger.Error(message, err)
-		return nil, nil, err
+		return nil, nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	handle, err := fileNode.Open(ctx, &fuse.OpenRequest{}, &fuse.OpenResponse{})
 	if err != nil {
 		message := fmt.Sprintf("Failed to open file node %s", request.Name)
-		node.logger.Error(message, err)
-		return nil, nil, err
+		return nil, nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	return fileNode, handle, nil
@@ -246,11 +240,10 @@ func (node *Node) Mkdir(ctx context.Context, request *fuse.MkdirRequest) (fs.Nod
 
 	fileSystem := node.client.GetFileSystem()
 
-	newDir, err := fileSystem.MkDir(node.GetIdentifier(), request.Name)
+	newDir, err := fileSystem.MkDir(ctx, node.GetIdentifier(), request.Name)
 	if err != nil {
 		message := fmt.Sprintf("Failed to mkdir %s", request.Name)
-		node.logger.Error(message, err)
-		return nil, err
+		return nil, errno.ReportWrite(ctx, node.logger, message, err)
 	}
 
 	return node.directoryNodeService.New(newDir.GetId())
@@ -273,11 +266,10 @@ func (node *Node) Link(ctx context.Context, request *fuse.LinkRequest, oldNode f
 
 	fileSystem := node.client.GetFileSystem()
 
-	err := fileSystem.Link(node.GetIdentifier(), request.NewName, oldFile.GetIdentifier())
+	err := fileSystem.Link(ctx, node.GetIdentifier(), request.NewName, oldFile.GetIdentifier())
 	if err != nil {
 		message := fmt.Sprintf("Failed to link %s", request.NewName)
-		node.logger.Error(message, err)
-		return nil, err
+		return nil, errno.ReportWrite(ctx, node.logger, message, err)
 	}
 
 	return oldFile, nil
@@ -2,10 +2,12 @@ package handle
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"sync/atomic"
 	"syscall"
 
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
 	"fuse_video_streamer/logger"
 
@@ -60,10 +62,10 @@ func (handle *Handle) ReadAll(ctx context.Context) ([]byte, error) {
 	client := handle.node.GetClient()
 	fileSystem := client.GetFileSystem()
 
-	data, err := fileSystem.ReadFile(handle.node.GetIdentifier(), 0, handle.node.GetSize())
-
+	data, err := fileSystem.ReadFile(ctx, handle.node.GetIdentifier(), 0, handle.node.GetSize())
 	if err != nil {
-		return nil, err
+		message := fmt.Sprintf("Failed to read file %d", handle.node.GetIdentifier())
+		return nil, errno.Report(ctx, handle.logger, message, err)
 	}
 
 	return data, nil
@@ -80,9 +82,10 @@ func (handle *Handle) Read(ctx context.Context, readRequest *fuse.ReadRequest, r
 	client := handle.node.GetClient()
 	fileSystem := client.GetFileSystem()
 
-	data, err := fileSystem.ReadFile(handle.node.GetIdentifier(), uint64(readRequest.Offset), uint64(readRequest.Size))
+	data, err := fileSystem.ReadFile(ctx, handle.node.GetIdentifier(), uint64(readRequest.Offset), uint64(readRequest.Size))
 	if err != nil {
-		return err
+		message := fmt.Sprintf("Failed to read file %d", handle.node.GetIdentifier())
+		return errno.Report(ctx, handle.logger, message, err)
 	}
 
 	readResponse.Data = data
@@ -101,9 +104,10 @@ func (handle *Handle) Write(ctx context.Context, writeRequest *fuse.WriteRequest
 	client := handle.node.GetClient()
 	fileSystem := client.GetFileSystem()
 
-	bytesWritten, err := fileSystem.WriteFile(handle.node.GetIdentifier(), uint64(writeRequest.Offset), writeRequest.Data)
+	bytesWritten, err := fileSystem.WriteFile(ctx, handle.node.GetIdentifier(), uint64(writeRequest.Offset), writeRequest.Data)
 	if err != nil {
-		return err
+		message := fmt.Sprintf("Failed to write file %d", handle.node.GetIdentifier())
+		return errno.ReportWrite(ctx, handle.logger, message, err)
 	}
 
 	writeResponse.Size = int(bytesWritten)
@@ -76,6 +76,7 @@ func (node *Node) Attr(ctx context.Context, attr *fuse.Attr) error {
 
 	attr.Mode = os.FileMode(0)
 	attr.Size = node.size
+	attr.Valid = node.client.GetMetadataTTL().Attr
 
 	return nil
 }
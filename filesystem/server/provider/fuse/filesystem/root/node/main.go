@@ -10,6 +10,7 @@ import (
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
 	filesystem_provider_repository "fuse_video_streamer/filesystem/client/repository"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	directory_node_service_factory "fuse_video_streamer/filesystem/server/provider/fuse/filesystem/directory/node/service/factory"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
 	"fuse_video_streamer/logger"
@@ -88,16 +89,16 @@ func (node *node) Lookup(ctx context.Context, lookupRequest *fuse.LookupRequest,
 
 	client, err := node.fileSystemProviderRepository.GetClientByName(lookupRequest.Name)
 	if err != nil {
-		return nil, err
+		message := fmt.Sprintf("Failed to get client %s", lookupRequest.Name)
+		return nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	fileSystem := client.GetFileSystem()
 
-	root, err := fileSystem.Root(client.GetName())
+	root, err := fileSystem.Root(ctx, client.GetName())
 	if err != nil {
 		message := fmt.Sprintf("Failed to get root for client %s", lookupRequest.Name)
-		node.logger.Error(message, err)
-		return nil, err
+		return nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	directoryNodeService, err := node.directoryNodeServiceFactory.New(client)
@@ -105,6 +106,8 @@ func (node *node) Lookup(ctx context.Context, lookupRequest *fuse.LookupRequest,
 		return nil, err
 	}
 
+	lookupResponse.EntryValid = client.GetMetadataTTL().Entry
+
 	return directoryNodeService.New(root.GetId())
 }
 
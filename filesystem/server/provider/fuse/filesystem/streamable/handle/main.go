@@ -8,8 +8,8 @@ import (
 	"sync/atomic"
 	"syscall"
 
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
-	"fuse_video_streamer/filesystem/server/provider/fuse/pool"
 	"fuse_video_streamer/logger"
 	"fuse_video_streamer/stream"
 
@@ -26,7 +26,7 @@ type Handle struct {
 
 	id uint64
 
-	stream *stream.Stream
+	stream *stream.Reader
 
 	logger *logger.Logger
 
@@ -39,7 +39,7 @@ var _ interfaces.StreamableHandle = &Handle{}
 
 var incrementId uint64
 
-func New(node interfaces.StreamableNode, stream *stream.Stream, logger *logger.Logger) *Handle {
+func New(node interfaces.StreamableNode, stream *stream.Reader, logger *logger.Logger) *Handle {
 	incrementId++
 
 	return &Handle{
@@ -57,15 +57,18 @@ func (handle *Handle) GetIdentifier() uint64 {
 	return handle.id
 }
 
+// Read may be called concurrently, the lock is only held to get the reader so
+// reads of buffered data do not wait behind reads that wait for a download
 func (handle *Handle) Read(ctx context.Context, readRequest *fuse.ReadRequest, readResponse *fuse.ReadResponse) error {
-	handle.mu.RLock()
-	defer handle.mu.RUnlock()
-
 	if handle.IsClosed() {
 		return syscall.ENOENT
 	}
 
-	if handle.stream == nil {
+	handle.mu.RLock()
+	reader := handle.stream
+	handle.mu.RUnlock()
+
+	if reader == nil {
 		message := fmt.Sprintf("No video stream for handle %d, closing video stream", handle.id)
 		handle.logger.Error(message, nil)
 
@@ -74,34 +77,55 @@ func (handle *Handle) Read(ctx context.Context, readRequest *fuse.ReadRequest, r
 		return syscall.ENOENT
 	}
 
-	fileSize := handle.node.GetSize()
-
-	buffer := pool.GetBuffer(int64(fileSize))
-	defer pool.PutBuffer(buffer)
+	// The server hands out a response buffer of the requested size, the
+	// cached chunks are copied straight into it
+	buffer := readResponse.Data[:0]
+	if cap(buffer) < readRequest.Size {
+		buffer = make([]byte, readRequest.Size)
+	}
 
-	bytesRead, err := handle.stream.ReadAt(buffer[:readRequest.Size], readRequest.Offset)
+	bytesRead, err := reader.ReadAtContext(ctx, buffer[:readRequest.Size], readRequest.Offset)
 
-	switch err {
+	switch {
 
-	case nil:
+	case err == nil:
 		readResponse.Data = buffer[:bytesRead]
 		return nil
 
-	case io.EOF:
+	case err == io.EOF:
 		readResponse.Data = buffer[:bytesRead]
 		return nil
 
+	case ctx.Err() != nil:
+		// The read was interrupted, the stream stays open for the next one
+		return syscall.EINTR
+
 	default:
 		message := fmt.Sprintf("Failed to read video stream for handle %d, closing video stream", handle.id)
 		handle.logger.Error(message, err)
 
-		handle.stream.Close()
-		handle.stream = nil
+		if stream.IsChanged(err) {
+			handle.node.Invalidate()
+		}
 
-		return err
+		handle.closeStream(reader)
+
+		return errno.FromError(ctx, err)
 	}
 }
 
+// closeStream closes the reader after a read failed, concurrent reads may
+// fail on it as well
+func (handle *Handle) closeStream(reader *stream.Reader) {
+	handle.mu.Lock()
+	if handle.stream == reader {
+		handle.stream = nil
+	}
+	handle.mu.Unlock()
+
+	reader.Close()
+}
+
 func (handle *Handle) Release(ctx context.Context, releaseRequest *fuse.ReleaseRequest) error {
 	handle.Close()
 
@@ -113,8 +137,12 @@ func (handle *Handle) Close() error {
 		return nil
 	}
 
-	if handle.stream != nil {
-		handle.stream.Close()
+	handle.mu.Lock()
+	reader := handle.stream
+	handle.mu.Unlock()
+
+	if reader != nil {
+		reader.Close()
 	}
 
 	return nil
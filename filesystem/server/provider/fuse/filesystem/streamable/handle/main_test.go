@@ -0,0 +1,159 @@
+package handle
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream"
+	"fuse_video_streamer/stream/connection"
+
+	"github.com/anacrolix/fuse"
+)
+
+// TestMain runs the tests in a directory with a minimal config file, the
+// stream packages read it on first use
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "handle")
+	if err != nil {
+		panic(err)
+	}
+
+	config := []byte("mount_point: /tmp/fvs\nvolume_name: fvs\n")
+	if err := os.WriteFile(filepath.Join(directory, "config.yml"), config, 0644); err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(directory); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+type node struct {
+	interfaces.StreamableNode
+}
+
+func (node *node) Invalidate() {}
+
+func TestReadOfMissingSourceIsENOENT(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+
+	resolve := func(ctx context.Context, refresh bool) (*stream.Descriptor, error) {
+		return &stream.Descriptor{
+			Sources: []connection.Source{{Url: server.URL}},
+		}, nil
+	}
+
+	reader, err := stream.Open(context.Background(), t.Name(), 1024*1024, stream.Options{}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logger, err := logger.NewLogger("Handle Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle := New(&node{}, reader, logger)
+	defer handle.Close()
+
+	readRequest := &fuse.ReadRequest{Offset: 0, Size: 4096}
+	readResponse := &fuse.ReadResponse{Data: make([]byte, 0, readRequest.Size)}
+
+	err = handle.Read(context.Background(), readRequest, readResponse)
+	if err != syscall.ENOENT {
+		t.Fatalf("expected ENOENT, got %v", err)
+	}
+}
+
+// openCached returns a handle on a stream whose content was read once, so
+// later reads are served from the cached chunks
+func openCached(b *testing.B, size int) *Handle {
+	content := bytes.Repeat([]byte{1}, size)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	b.Cleanup(server.Close)
+
+	resolve := func(ctx context.Context, refresh bool) (*stream.Descriptor, error) {
+		return &stream.Descriptor{
+			Sources: []connection.Source{{Url: server.URL}},
+		}, nil
+	}
+
+	reader, err := stream.Open(context.Background(), b.Name(), int64(size), stream.Options{}, resolve)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	logger, err := logger.NewLogger("Handle Test")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	handle := New(&node{}, reader, logger)
+	b.Cleanup(func() { handle.Close() })
+
+	buffer := make([]byte, size)
+	if _, err := reader.ReadAt(buffer, 0); err != nil {
+		b.Fatal(err)
+	}
+
+	return handle
+}
+
+// BenchmarkRead reads cached 128KB ranges like the FUSE server does, which
+// hands every read a new response buffer of the requested size
+func BenchmarkRead(b *testing.B) {
+	const size = 4 * 1024 * 1024
+	const readSize = 128 * 1024
+
+	handle := openCached(b, size)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		readRequest := &fuse.ReadRequest{Offset: int64(i*readSize) % size, Size: readSize}
+		readResponse := &fuse.ReadResponse{Data: make([]byte, 0, readRequest.Size)}
+
+		if err := handle.Read(context.Background(), readRequest, readResponse); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// BenchmarkReadAt reads cached 128KB ranges into the same buffer
+func BenchmarkReadAt(b *testing.B) {
+	const size = 4 * 1024 * 1024
+	const readSize = 128 * 1024
+
+	handle := openCached(b, size)
+	buffer := make([]byte, readSize)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if _, err := handle.stream.ReadAt(buffer, int64(i*readSize)%size); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
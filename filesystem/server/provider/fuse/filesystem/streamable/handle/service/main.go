@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"sync/atomic"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
@@ -32,7 +33,7 @@ func New(
 	}
 }
 
-func (service *Service) New() (interfaces.StreamableHandle, error) {
+func (service *Service) New(ctx context.Context) (interfaces.StreamableHandle, error) {
 	if service.IsClosed() {
 		return nil, nil
 	}
@@ -42,12 +43,12 @@ func (service *Service) New() (interfaces.StreamableHandle, error) {
 		return nil, err
 	}
 
-	stream, err := service.streamFactory.NewStream(service.node.GetIdentifier(), service.node.GetSize())
+	reader, err := service.streamFactory.NewReader(ctx, service.node.GetIdentifier(), service.node.GetSize())
 	if err != nil {
 		return nil, err
 	}
 
-	return handle.New(service.node, stream, logger), nil
+	return handle.New(service.node, reader, logger), nil
 }
 
 func (service *Service) Close() error {
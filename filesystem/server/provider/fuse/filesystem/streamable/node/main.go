@@ -2,15 +2,18 @@ package node
 
 import (
 	"context"
+	"errors"
 	"os"
 	"sync"
 	"sync/atomic"
 	"syscall"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	streamable_handle_service_factory "fuse_video_streamer/filesystem/server/provider/fuse/filesystem/streamable/handle/service/factory"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
 	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream/memory"
 
 	"github.com/anacrolix/fuse"
 	"github.com/anacrolix/fuse/fs"
@@ -21,7 +24,8 @@ type Node struct {
 
 	client     filesystem_client_interfaces.Client
 	identifier uint64
-	size       uint64
+	size       atomic.Uint64
+	stale      atomic.Bool
 
 	handles []interfaces.StreamableHandle
 
@@ -36,10 +40,8 @@ var _ interfaces.StreamableNode = &Node{}
 
 func New(client filesystem_client_interfaces.Client, logger *logger.Logger, identifier uint64, size uint64) *Node {
 	node := &Node{
-		client:        client,
-		identifier:    identifier,
-
-		size: size,
+		client:     client,
+		identifier: identifier,
 
 		logger: logger,
 
@@ -53,6 +55,7 @@ func New(client filesystem_client_interfaces.Client, logger *logger.Logger, iden
 	}
 
 	node.handleService = fileHandleService
+	node.size.Store(size)
 
 	return node
 }
@@ -62,7 +65,27 @@ func (node *Node) GetIdentifier() uint64 {
 }
 
 func (node *Node) GetSize() uint64 {
-	return node.size
+	return node.getSize(context.Background())
+}
+
+// getSize fetches the size again when the node was invalidated
+func (node *Node) getSize(ctx context.Context) uint64 {
+	if node.stale.CompareAndSwap(true, false) {
+		size, err := node.client.GetFileSystem().GetFileInfo(ctx, node.identifier)
+		if err != nil {
+			node.logger.Error("Failed to refresh the size of a changed file", err)
+			node.stale.Store(true)
+		} else {
+			node.size.Store(size)
+		}
+	}
+
+	return node.size.Load()
+}
+
+func (node *Node) Invalidate() {
+	node.client.GetFileSystem().Invalidate(node.identifier)
+	node.stale.Store(true)
 }
 
 func (node *Node) GetClient() filesystem_client_interfaces.Client {
@@ -75,7 +98,8 @@ func (node *Node) Attr(ctx context.Context, attr *fuse.Attr) error {
 	}
 
 	attr.Mode = os.FileMode(0)
-	attr.Size = node.size
+	attr.Size = node.getSize(ctx)
+	attr.Valid = node.client.GetMetadataTTL().Attr
 
 	return nil
 }
@@ -88,11 +112,15 @@ func (node *Node) Open(ctx context.Context, openRequest *fuse.OpenRequest, openR
 		return nil, syscall.ENOENT
 	}
 
-	handle, err := node.handleService.New()
+	handle, err := node.handleService.New(ctx)
+	if errors.Is(err, memory.ErrExhausted) {
+		node.logger.Warn(err.Error())
+		return nil, syscall.ENOMEM
+	}
+
 	if err != nil {
 		message := "Failed to create file handle"
-		node.logger.Error(message, err)
-		return nil, err
+		return nil, errno.Report(ctx, node.logger, message, err)
 	}
 
 	node.handles = append(node.handles, handle)
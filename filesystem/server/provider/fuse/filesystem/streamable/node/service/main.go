@@ -1,11 +1,13 @@
 package service
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"sync/atomic"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 	"fuse_video_streamer/filesystem/server/provider/fuse/filesystem/streamable/node"
 	"fuse_video_streamer/filesystem/server/provider/fuse/interfaces"
 	"fuse_video_streamer/filesystem/server/provider/fuse/registry"
@@ -34,7 +36,7 @@ func New(client filesystem_client_interfaces.Client, logger *logger.Logger) (int
 	}, nil
 }
 
-func (service *Service) New(identifier uint64) (interfaces.StreamableNode, error) {
+func (service *Service) New(ctx context.Context, identifier uint64) (interfaces.StreamableNode, error) {
 	service.mu.Lock()
 	defer service.mu.Unlock()
 
@@ -49,12 +51,11 @@ func (service *Service) New(identifier uint64) (interfaces.StreamableNode, error
 
 	fileSystem := service.client.GetFileSystem()
 
-	size, err := fileSystem.GetFileInfo(identifier)
+	size, err := fileSystem.GetFileInfo(ctx, identifier)
 
 	if err != nil {
 		message := fmt.Sprintf("Failed to get video size for %d", identifier)
-		service.logger.Error(message, err)
-		return nil, err
+		return nil, errno.Report(ctx, service.logger, message, err)
 	}
 
 	newNode := node.New(service.client, logger, identifier, size)
@@ -8,6 +8,7 @@ import (
 	"syscall"
 
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
+	"fuse_video_streamer/filesystem/server/provider/fuse/errno"
 
 	"github.com/anacrolix/fuse"
 )
@@ -26,6 +27,7 @@ func New(client filesystem_client_interfaces.Client, identifier uint64) *Symlink
 
 func (symlink *Symlink) Attr(ctx context.Context, attr *fuse.Attr) error {
 	attr.Mode = os.ModeSymlink
+	attr.Valid = symlink.client.GetMetadataTTL().Attr
 
 	return nil
 }
@@ -33,9 +35,9 @@ func (symlink *Symlink) Attr(ctx context.Context, attr *fuse.Attr) error {
 func (symlink *Symlink) Readlink(ctx context.Context, req *fuse.ReadlinkRequest) (string, error) {
 	fileSystem := symlink.client.GetFileSystem()
 
-	linkPath, err := fileSystem.ReadLink(symlink.identifier)
+	linkPath, err := fileSystem.ReadLink(ctx, symlink.identifier)
 	if err != nil {
-		return "", syscall.ENOENT
+		return "", errno.FromError(ctx, err)
 	}
 
 	mountPath := config.GetMountPoint()
@@ -1,6 +1,8 @@
 package interfaces
 
 import (
+	"context"
+
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
 
 	"github.com/anacrolix/fuse/fs"
@@ -61,7 +63,7 @@ type StreamableHandleServiceFactory interface {
 type StreamableHandleService interface {
 	useClosable
 
-	New() (StreamableHandle, error)
+	New(ctx context.Context) (StreamableHandle, error)
 	Close() error
 }
 
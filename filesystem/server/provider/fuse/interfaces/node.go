@@ -1,6 +1,8 @@
 package interfaces
 
 import (
+	"context"
+
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
 
 	"github.com/anacrolix/fuse/fs"
@@ -70,7 +72,7 @@ type StreamableNodeServiceFactory interface {
 type StreamableNodeService interface {
 	useClosable
 
-	New(identifier uint64) (StreamableNode, error)
+	New(ctx context.Context, identifier uint64) (StreamableNode, error)
 }
 
 type StreamableNode interface {
@@ -80,6 +82,9 @@ type StreamableNode interface {
 
 	GetSize() uint64
 	GetClient() filesystem_client_interfaces.Client
+
+	// Invalidate makes the node fetch its size again because the remote file changed
+	Invalidate()
 }
 
 // --- File
@@ -91,7 +96,7 @@ type FileNodeServiceFactory interface {
 type FileNodeService interface {
 	useClosable
 
-	New(identifier uint64) (FileNode, error)
+	New(ctx context.Context, identifier uint64) (FileNode, error)
 }
 
 type FileNode interface {
@@ -26,7 +26,7 @@ func GetInstance(client client_interfaces.Client) *Registry {
 
 	fileSystem := client.GetFileSystem()
 
-	root, err := fileSystem.Root(client.GetName())
+	root, err := fileSystem.Root(context.Background(), client.GetName())
 	if err != nil {
 		panic(err)
 	}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -14,6 +15,7 @@ import (
 var LogDir = "logs"
 
 var loggers = make(map[string]*zap.SugaredLogger)
+var loggersMu sync.Mutex
 
 func createLogger(fileName string) (*zap.SugaredLogger, error) {
 	filePath := filepath.Join(LogDir, fileName)
@@ -44,6 +46,9 @@ func createLogger(fileName string) (*zap.SugaredLogger, error) {
 }
 
 func getLogger(fileName string) (*zap.SugaredLogger, error) {
+	loggersMu.Lock()
+	defer loggersMu.Unlock()
+
 	if logger, ok := loggers[fileName]; ok {
 		return logger, nil
 	}
@@ -0,0 +1,136 @@
+package bandwidth
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Smallest burst so a single read of a transfer always fits in the bucket
+const minimumBurst = 256 * 1024
+
+// How long playback keeps priority after its last transfer
+const playbackHold = time.Second
+
+// Limiter is a token bucket that allows a rate of bytes per second, the rate
+// can be changed at any time and zero disables the limit
+type Limiter struct {
+	rate   int64
+	tokens float64
+	last   time.Time
+
+	lastPlayback time.Time
+
+	mu sync.Mutex
+}
+
+func NewLimiter(rate int64) *Limiter {
+	return &Limiter{
+		rate:   max(rate, 0),
+		tokens: float64(burst(rate)),
+		last:   time.Now(),
+	}
+}
+
+func burst(rate int64) int64 {
+	return max(rate, minimumBurst)
+}
+
+func (limiter *Limiter) Rate() int64 {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	return limiter.rate
+}
+
+func (limiter *Limiter) SetRate(rate int64) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.refill(time.Now())
+
+	limiter.rate = max(rate, 0)
+	limiter.tokens = min(limiter.tokens, float64(burst(limiter.rate)))
+}
+
+func (limiter *Limiter) refill(now time.Time) {
+	elapsed := now.Sub(limiter.last).Seconds()
+	limiter.last = now
+
+	if limiter.rate == 0 {
+		limiter.tokens = float64(burst(0))
+		return
+	}
+
+	limiter.tokens = min(limiter.tokens+elapsed*float64(limiter.rate), float64(burst(limiter.rate)))
+}
+
+// reserve takes n tokens and returns how long the caller has to wait before
+// they are available, the bucket goes into debt so waiters are served in order.
+// While playback is active, other classes pay more tokens for the same bytes
+// which gives playback the larger share of the rate.
+func (limiter *Limiter) reserve(n int, class Class) time.Duration {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	if limiter.rate == 0 {
+		return 0
+	}
+
+	now := time.Now()
+	limiter.refill(now)
+
+	cost := float64(n)
+
+	if class == Playback {
+		limiter.lastPlayback = now
+	} else if now.Sub(limiter.lastPlayback) < playbackHold {
+		cost *= class.cost()
+	}
+
+	limiter.tokens -= cost
+
+	if limiter.tokens >= 0 {
+		return 0
+	}
+
+	return time.Duration(-limiter.tokens / float64(limiter.rate) * float64(time.Second))
+}
+
+// Wait blocks until n bytes of the class are allowed
+func (limiter *Limiter) Wait(ctx context.Context, n int, class Class) error {
+	return wait(ctx, limiter.reserve(n, class))
+}
+
+func wait(ctx context.Context, delay time.Duration) error {
+	if delay <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Chain applies several limiters at once, like the limits of a stream, its
+// provider and the global limit
+type Chain []*Limiter
+
+// Wait blocks until n bytes of the class are allowed by every limiter of the chain
+func (chain Chain) Wait(ctx context.Context, n int, class Class) error {
+	var delay time.Duration
+
+	for _, limiter := range chain {
+		if limiter != nil {
+			delay = max(delay, limiter.reserve(n, class))
+		}
+	}
+
+	return wait(ctx, delay)
+}
@@ -0,0 +1,159 @@
+package bandwidth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+)
+
+const rate = 1024 * 1024
+
+// Tolerance for the time that passes between the calls of a test
+const tolerance = 50 * time.Millisecond
+
+func expectDelay(t *testing.T, delay time.Duration, expected time.Duration) {
+	t.Helper()
+
+	if delay < expected-tolerance || delay > expected+tolerance {
+		t.Fatalf("got delay %s, expected %s", delay, expected)
+	}
+}
+
+func TestRefill(t *testing.T) {
+	limiter := NewLimiter(rate)
+
+	if limiter.tokens != rate {
+		t.Fatalf("new bucket holds %f tokens instead of being full", limiter.tokens)
+	}
+
+	now := time.Now()
+
+	limiter.tokens = 0
+	limiter.last = now.Add(-250 * time.Millisecond)
+	limiter.refill(now)
+
+	if math.Abs(limiter.tokens-rate/4) > 1 {
+		t.Fatalf("got %f tokens after a quarter second, expected %d", limiter.tokens, rate/4)
+	}
+
+	// Debt is paid off before tokens become available again
+	limiter.tokens = -rate / 2
+	limiter.last = now.Add(-time.Second)
+	limiter.refill(now)
+
+	if math.Abs(limiter.tokens-rate/2) > 1 {
+		t.Fatalf("got %f tokens after paying off the debt, expected %d", limiter.tokens, rate/2)
+	}
+
+	// The bucket never holds more than its burst
+	limiter.last = now.Add(-time.Minute)
+	limiter.refill(now)
+
+	if limiter.tokens != rate {
+		t.Fatalf("got %f tokens after a minute, expected the burst of %d", limiter.tokens, rate)
+	}
+}
+
+func TestMinimumBurst(t *testing.T) {
+	limiter := NewLimiter(1000)
+
+	if delay := limiter.reserve(minimumBurst, Playback); delay != 0 {
+		t.Fatalf("a read of the minimum burst had to wait %s", delay)
+	}
+
+	now := time.Now()
+
+	limiter.last = now.Add(-time.Hour)
+	limiter.refill(now)
+
+	if limiter.tokens != minimumBurst {
+		t.Fatalf("got %f tokens, expected the minimum burst of %d", limiter.tokens, minimumBurst)
+	}
+}
+
+func TestReserveQueuesWaiters(t *testing.T) {
+	limiter := NewLimiter(rate)
+
+	if delay := limiter.reserve(rate, Playback); delay != 0 {
+		t.Fatalf("the burst had to wait %s", delay)
+	}
+
+	// Every waiter waits for the tokens of the ones before it as well
+	expectDelay(t, limiter.reserve(rate/2, Playback), 500*time.Millisecond)
+	expectDelay(t, limiter.reserve(rate/2, Playback), time.Second)
+}
+
+func TestUnlimited(t *testing.T) {
+	limiter := NewLimiter(0)
+
+	for range 10 {
+		if delay := limiter.reserve(10*rate, Background); delay != 0 {
+			t.Fatalf("unlimited reservation had to wait %s", delay)
+		}
+	}
+
+	// Setting a rate starts from the minimum burst the unlimited bucket holds
+	limiter.SetRate(rate)
+
+	if delay := limiter.reserve(minimumBurst, Playback); delay != 0 {
+		t.Fatalf("the minimum burst had to wait %s after setting a rate", delay)
+	}
+
+	expectDelay(t, limiter.reserve(rate, Playback), time.Second)
+}
+
+func TestSetRateLimitsTokens(t *testing.T) {
+	limiter := NewLimiter(10 * rate)
+
+	limiter.SetRate(rate)
+
+	if limiter.tokens > rate {
+		t.Fatalf("got %f tokens, more than the burst of the new rate", limiter.tokens)
+	}
+
+	limiter.SetRate(-1)
+
+	if limiter.Rate() != 0 {
+		t.Fatalf("negative rate was set as %d", limiter.Rate())
+	}
+}
+
+func TestBackgroundCostDuringPlayback(t *testing.T) {
+	limiter := NewLimiter(rate)
+
+	limiter.reserve(rate, Background)
+
+	// Without playback background bytes cost a token each
+	expectDelay(t, limiter.reserve(rate/4, Background), 250*time.Millisecond)
+
+	limiter = NewLimiter(rate)
+
+	limiter.reserve(rate, Playback)
+
+	expectDelay(t, limiter.reserve(rate/4, Background), time.Duration(PlaybackWeight)*250*time.Millisecond)
+	expectDelay(t, limiter.reserve(rate/4, Playback), time.Duration(PlaybackWeight+1)*250*time.Millisecond)
+}
+
+func TestChainWaitsForSlowestLimiter(t *testing.T) {
+	fast := NewLimiter(4 * rate)
+	slow := NewLimiter(rate)
+
+	chain := Chain{fast, nil, slow}
+
+	if err := chain.Wait(context.Background(), rate, Playback); err != nil {
+		t.Fatalf("the burst of the slow limiter failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := chain.Wait(ctx, rate, Playback); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected a canceled wait, got %v", err)
+	}
+
+	// The canceled wait still took the tokens of both limiters
+	expectDelay(t, slow.reserve(rate/2, Playback), 1500*time.Millisecond)
+	expectDelay(t, fast.reserve(4*rate, Playback), 500*time.Millisecond)
+}
@@ -0,0 +1,162 @@
+package bandwidth
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/logger"
+)
+
+const reloadInterval = 10 * time.Second
+
+// Manager holds the global, per provider and per stream limiters, the limits
+// are reloaded from the config while running
+type Manager struct {
+	global    *Limiter
+	providers map[string]*Limiter
+	streams   map[*Limiter]struct{}
+
+	streamRate int64
+
+	logger *logger.Logger
+
+	mu sync.Mutex
+}
+
+var instance *Manager
+var instanceOnce sync.Once
+
+func GetInstance() *Manager {
+	instanceOnce.Do(func() {
+		logger, err := logger.NewLogger("Bandwidth")
+		if err != nil {
+			panic(err)
+		}
+
+		instance = New(logger)
+		instance.reload()
+
+		go instance.watch()
+	})
+
+	return instance
+}
+
+func New(logger *logger.Logger) *Manager {
+	return &Manager{
+		global:    NewLimiter(0),
+		providers: make(map[string]*Limiter),
+		streams:   make(map[*Limiter]struct{}),
+
+		logger: logger,
+	}
+}
+
+// NewShare returns the share of a new stream of the provider, it follows the
+// configured stream limit until it is released
+func (manager *Manager) NewShare(provider string) *Share {
+	providerLimiter := manager.provider(provider)
+
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	limiter := NewLimiter(manager.streamRate)
+	manager.streams[limiter] = struct{}{}
+
+	return &Share{
+		limiter: limiter,
+		chain:   Chain{limiter, providerLimiter, manager.global},
+	}
+}
+
+func (manager *Manager) ReleaseShare(share *Share) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	delete(manager.streams, share.limiter)
+}
+
+func (manager *Manager) provider(name string) *Limiter {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	limiter, ok := manager.providers[name]
+	if !ok {
+		limiter = NewLimiter(0)
+		manager.providers[name] = limiter
+	}
+
+	return limiter
+}
+
+func (manager *Manager) SetGlobalRate(rate int64) {
+	manager.global.SetRate(rate)
+}
+
+func (manager *Manager) SetProviderRate(name string, rate int64) {
+	manager.provider(name).SetRate(rate)
+}
+
+// SetStreamRate changes the limit of every open and future stream
+func (manager *Manager) SetStreamRate(rate int64) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.streamRate = rate
+
+	for limiter := range manager.streams {
+		limiter.SetRate(rate)
+	}
+}
+
+func (manager *Manager) watch() {
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		manager.reload()
+	}
+}
+
+// reload applies the limits of the config file, a config that can not be
+// read keeps the current limits
+func (manager *Manager) reload() {
+	cfg, err := config.Load()
+	if err != nil {
+		manager.logger.Error("Failed to reload bandwidth limits", err)
+		return
+	}
+
+	manager.apply("global", manager.global, toRate(cfg.Bandwidth.RateLimitMbit))
+
+	for _, fileServer := range cfg.FileServers {
+		manager.apply(fileServer.Name, manager.provider(fileServer.Name), toRate(fileServer.RateLimitMbit))
+	}
+
+	streamRate := toRate(cfg.Bandwidth.StreamRateLimitMbit)
+
+	manager.mu.Lock()
+	changed := manager.streamRate != streamRate
+	manager.mu.Unlock()
+
+	if changed {
+		manager.SetStreamRate(streamRate)
+		manager.logger.Info(fmt.Sprintf("Stream bandwidth limit set to %d bytes per second", streamRate))
+	}
+}
+
+func (manager *Manager) apply(name string, limiter *Limiter, rate int64) {
+	if limiter.Rate() == rate {
+		return
+	}
+
+	limiter.SetRate(rate)
+	manager.logger.Info(fmt.Sprintf("Bandwidth limit of %s set to %d bytes per second", name, rate))
+}
+
+// toRate converts megabits per second to bytes per second
+func toRate(megabits float64) int64 {
+	return int64(max(megabits, 0) * 1000 * 1000 / 8)
+}
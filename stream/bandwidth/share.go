@@ -0,0 +1,65 @@
+package bandwidth
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Class is the priority of a stream when it competes for limited bandwidth
+type Class int32
+
+const (
+	// Background streams are read by scanners, thumbnailers and prefetching
+	Background Class = iota
+
+	// Playback streams are read by a player and get the larger share
+	Playback
+)
+
+// Weights of the classes, a class gets bandwidth in proportion to its weight
+const (
+	BackgroundWeight = 1
+	PlaybackWeight   = 4
+)
+
+func (class Class) String() string {
+	switch class {
+	case Playback:
+		return "playback"
+	default:
+		return "background"
+	}
+}
+
+// cost is how many tokens a byte of the class takes while playback is active
+func (class Class) cost() float64 {
+	switch class {
+	case Playback:
+		return 1
+	default:
+		return PlaybackWeight / BackgroundWeight
+	}
+}
+
+// Share is the bandwidth of a single stream, bound by its own limit, the
+// limit of its provider and the global limit and weighted by its class
+type Share struct {
+	limiter *Limiter
+	chain   Chain
+
+	class atomic.Int32
+}
+
+func (share *Share) Class() Class {
+	return Class(share.class.Load())
+}
+
+// SetClass changes the class and reports whether it was different
+func (share *Share) SetClass(class Class) bool {
+	return Class(share.class.Swap(int32(class))) != class
+}
+
+// Wait blocks until n bytes are allowed
+func (share *Share) Wait(ctx context.Context, n int) error {
+	return share.chain.Wait(ctx, n, share.Class())
+}
@@ -0,0 +1,76 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/logger"
+)
+
+const DefaultCgroupPercent = int64(50) // Share of the cgroup memory limit used by streams
+
+// Limits above this are reported by cgroup v1 when the memory is not limited
+const unlimitedCgroup = int64(1) << 60
+
+var cgroupLimitFiles = []string{
+	"/sys/fs/cgroup/memory.max",                   // cgroup v2
+	"/sys/fs/cgroup/memory/memory.limit_in_bytes", // cgroup v1
+}
+
+// memoryBudget returns the configured memory limit, or a share of the cgroup
+// memory limit of the container when none is configured
+func memoryBudget(cacheConfig config.Cache, logger *logger.Logger) int64 {
+	cgroupLimit, limited := getCgroupLimit()
+
+	if cacheConfig.MemorySizeMB > 0 {
+		budget := cacheConfig.MemorySizeMB * 1024 * 1024
+
+		if limited && budget >= cgroupLimit {
+			logger.Warn(fmt.Sprintf("Memory budget of %dMB is not below the cgroup limit of %dMB", budget>>20, cgroupLimit>>20))
+		}
+
+		return budget
+	}
+
+	if !limited {
+		return DefaultMemoryLimit
+	}
+
+	percent := DefaultCgroupPercent
+	if cacheConfig.MemoryCgroupPercent > 0 {
+		percent = min(cacheConfig.MemoryCgroupPercent, 100)
+	}
+
+	budget := cgroupLimit / 100 * percent
+
+	logger.Info(fmt.Sprintf("Using %dMB of the cgroup limit of %dMB for streams", budget>>20, cgroupLimit>>20))
+
+	return budget
+}
+
+// getCgroupLimit reads the memory limit of the cgroup the process runs in
+func getCgroupLimit() (int64, bool) {
+	for _, path := range cgroupLimitFiles {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+
+		value := strings.TrimSpace(string(content))
+		if value == "max" {
+			return 0, false
+		}
+
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit <= 0 || limit >= unlimitedCgroup {
+			return 0, false
+		}
+
+		return limit, true
+	}
+
+	return 0, false
+}
@@ -0,0 +1,85 @@
+package cache
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Chunk is a fixed-size region of a stream. It is filled sequentially by a
+// single writer at a time while readers may read whatever is already filled.
+type Chunk struct {
+	data   []byte
+	filled atomic.Int64
+
+	mu sync.Mutex
+}
+
+func NewChunk(size int64) *Chunk {
+	return &Chunk{
+		data: make([]byte, size),
+	}
+}
+
+func NewCompleteChunk(data []byte) *Chunk {
+	chunk := &Chunk{
+		data: data,
+	}
+
+	chunk.filled.Store(int64(len(data)))
+
+	return chunk
+}
+
+func (chunk *Chunk) Len() int64 {
+	return int64(len(chunk.data))
+}
+
+func (chunk *Chunk) Filled() int64 {
+	return chunk.filled.Load()
+}
+
+func (chunk *Chunk) IsComplete() bool {
+	return chunk.Filled() == chunk.Len()
+}
+
+// Bytes returns the filled part of the chunk, it must not be modified
+func (chunk *Chunk) Bytes() []byte {
+	return chunk.data[:chunk.Filled()]
+}
+
+// ReadAt copies the filled data starting at offset into p and returns the amount of bytes copied
+func (chunk *Chunk) ReadAt(p []byte, offset int64) int {
+	filled := chunk.Filled()
+	if offset < 0 || offset >= filled {
+		return 0
+	}
+
+	return copy(p, chunk.data[offset:filled])
+}
+
+// WriteAt stores p at offset and returns how many bytes of p were consumed.
+// Bytes that are already filled are skipped, writing past the filled region
+// is not possible since that would leave a gap in the chunk.
+func (chunk *Chunk) WriteAt(p []byte, offset int64) int {
+	chunk.mu.Lock()
+	defer chunk.mu.Unlock()
+
+	if offset < 0 || offset >= chunk.Len() {
+		return 0
+	}
+
+	filled := chunk.Filled()
+	if offset > filled {
+		return 0
+	}
+
+	consumed := min(int64(len(p)), chunk.Len()-offset)
+
+	end := offset + consumed
+	if end > filled {
+		copy(chunk.data[filled:end], p[filled-offset:consumed])
+		chunk.filled.Store(end)
+	}
+
+	return int(consumed)
+}
@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultDiskLimit = int64(10 * 1024 * 1024 * 1024) // 10GB
+
+const chunkFileExtension = ".chunk"
+
+type diskEntry struct {
+	path string
+	size int64
+}
+
+// Disk persists complete chunks as files so they survive restarts. The least
+// recently used files are removed once the size limit is reached.
+type Disk struct {
+	directory string
+	chunkSize int64
+	limit     int64
+
+	entries map[string]*list.Element
+	lru     *list.List
+
+	size int64
+
+	mu sync.Mutex
+}
+
+// StreamKey identifies the chunks of a remote file, a changed file size
+// results in a different key so stale chunks are never served
+func StreamKey(provider string, nodeIdentifier uint64, size int64) string {
+	return fmt.Sprintf("%s/%d/%d", url.PathEscape(provider), nodeIdentifier, size)
+}
+
+func NewDisk(directory string, chunkSize int64, limit int64) (*Disk, error) {
+	err := os.MkdirAll(directory, 0777)
+	if err != nil {
+		return nil, err
+	}
+
+	disk := &Disk{
+		directory: directory,
+		chunkSize: chunkSize,
+		limit:     limit,
+
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+
+	err = disk.load()
+	if err != nil {
+		return nil, err
+	}
+
+	disk.mu.Lock()
+	disk.evict()
+	disk.mu.Unlock()
+
+	return disk, nil
+}
+
+func (disk *Disk) Load(key Key) ([]byte, bool) {
+	path := disk.path(key)
+
+	disk.mu.Lock()
+	element, ok := disk.entries[path]
+	if ok {
+		disk.lru.MoveToFront(element)
+	}
+	disk.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		disk.remove(path)
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+
+	return data, true
+}
+
+func (disk *Disk) Store(key Key, data []byte) error {
+	path := disk.path(key)
+
+	disk.mu.Lock()
+	_, ok := disk.entries[path]
+	disk.mu.Unlock()
+
+	if ok {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(path), 0777)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(filepath.Dir(path), "*.tmp")
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(data)
+	closeErr := file.Close()
+
+	if err == nil {
+		err = closeErr
+	}
+
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(file.Name())
+		return err
+	}
+
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	disk.add(path, int64(len(data)))
+	disk.evict()
+
+	return nil
+}
+
+func (disk *Disk) path(key Key) string {
+	name := fmt.Sprintf("%d_%d%s", disk.chunkSize, key.Index, chunkFileExtension)
+
+	return filepath.Join(disk.directory, filepath.FromSlash(key.Stream), name)
+}
+
+// load indexes the chunk files left behind by a previous run, oldest first
+func (disk *Disk) load() error {
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+
+	var files []file
+
+	err := filepath.WalkDir(disk.directory, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil || entry.IsDir() {
+			return err
+		}
+
+		if strings.HasSuffix(path, ".tmp") {
+			os.Remove(path)
+			return nil
+		}
+
+		if !strings.HasSuffix(path, chunkFileExtension) {
+			return nil
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			return nil
+		}
+
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+
+		return nil
+	})
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].modTime.Before(files[j].modTime)
+	})
+
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	for _, file := range files {
+		disk.add(file.path, file.size)
+	}
+
+	return nil
+}
+
+func (disk *Disk) add(path string, size int64) {
+	if element, ok := disk.entries[path]; ok {
+		disk.lru.MoveToFront(element)
+		return
+	}
+
+	disk.entries[path] = disk.lru.PushFront(&diskEntry{path: path, size: size})
+	disk.size += size
+}
+
+func (disk *Disk) remove(path string) {
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	element, ok := disk.entries[path]
+	if !ok {
+		return
+	}
+
+	disk.removeElement(element)
+}
+
+// RemoveStream deletes the files of every chunk of the stream
+func (disk *Disk) RemoveStream(stream string) {
+	disk.mu.Lock()
+	defer disk.mu.Unlock()
+
+	prefix := filepath.Join(disk.directory, filepath.FromSlash(stream)) + string(filepath.Separator)
+
+	for path, element := range disk.entries {
+		if strings.HasPrefix(path, prefix) {
+			disk.removeElement(element)
+		}
+	}
+}
+
+func (disk *Disk) evict() {
+	for disk.size > disk.limit {
+		element := disk.lru.Back()
+		if element == nil {
+			return
+		}
+
+		disk.removeElement(element)
+	}
+}
+
+func (disk *Disk) removeElement(element *list.Element) {
+	entry := disk.lru.Remove(element).(*diskEntry)
+
+	delete(disk.entries, entry.path)
+	disk.size -= entry.size
+
+	os.Remove(entry.path)
+
+	// Only succeeds once the directory of the stream is empty
+	os.Remove(filepath.Dir(entry.path))
+}
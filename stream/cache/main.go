@@ -0,0 +1,317 @@
+package cache
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/logger"
+)
+
+const (
+	DefaultChunkSize   = int64(1024 * 1024)       // 1MB
+	DefaultMemoryLimit = int64(512 * 1024 * 1024) // 512MB for all streams together
+	DefaultStreamLimit = int64(64 * 1024 * 1024)  // 64MB per stream
+)
+
+type Key struct {
+	Stream string
+	Index  int64
+}
+
+type entry struct {
+	key   Key
+	chunk *Chunk
+}
+
+// Cache keeps fixed-size chunks of every open stream in memory and evicts the
+// least recently used ones once the per-stream or global limit is reached.
+type Cache struct {
+	chunkSize   int64
+	limit       int64
+	streamLimit int64
+
+	entries map[Key]*list.Element
+	lru     *list.List
+
+	size   int64
+	usage  map[string]int64
+	limits map[string]int64
+
+	disk *Disk
+
+	logger *logger.Logger
+
+	mu sync.Mutex
+}
+
+var instance *Cache
+var instanceOnce sync.Once
+
+func GetInstance() *Cache {
+	instanceOnce.Do(func() {
+		cacheConfig := config.GetCache()
+
+		chunkSize := DefaultChunkSize
+		if cacheConfig.ChunkSizeMB > 0 {
+			chunkSize = cacheConfig.ChunkSizeMB * 1024 * 1024
+		}
+
+		logger, err := logger.NewLogger("Cache")
+		if err != nil {
+			panic(err)
+		}
+
+		limit := memoryBudget(cacheConfig, logger)
+
+		streamLimit := DefaultStreamLimit
+		if cacheConfig.StreamSizeMB > 0 {
+			streamLimit = cacheConfig.StreamSizeMB * 1024 * 1024
+		}
+
+		instance = New(chunkSize, limit, streamLimit)
+
+		if cacheConfig.DiskDirectory == "" {
+			return
+		}
+
+		diskLimit := DefaultDiskLimit
+		if cacheConfig.DiskSizeMB > 0 {
+			diskLimit = cacheConfig.DiskSizeMB * 1024 * 1024
+		}
+
+		disk, err := NewDisk(cacheConfig.DiskDirectory, chunkSize, diskLimit)
+		if err != nil {
+			instance.logger.Error("Failed to open disk cache, continuing without it", err)
+			return
+		}
+
+		instance.disk = disk
+	})
+
+	return instance
+}
+
+func New(chunkSize int64, limit int64, streamLimit int64) *Cache {
+	logger, err := logger.NewLogger("Cache")
+	if err != nil {
+		panic(err)
+	}
+
+	return &Cache{
+		chunkSize:   chunkSize,
+		limit:       max(limit, chunkSize),
+		streamLimit: max(min(streamLimit, limit), chunkSize),
+
+		entries: make(map[Key]*list.Element),
+		lru:     list.New(),
+
+		usage:  make(map[string]int64),
+		limits: make(map[string]int64),
+
+		logger: logger,
+	}
+}
+
+func (cache *Cache) ChunkSize() int64 {
+	return cache.chunkSize
+}
+
+// Limit is the memory all streams may use together
+func (cache *Cache) Limit() int64 {
+	return cache.limit
+}
+
+// StreamLimit is the memory a single stream may use unless it was given its own limit
+func (cache *Cache) StreamLimit() int64 {
+	return cache.streamLimit
+}
+
+// SetStreamLimit gives the stream its own limit, chunks above it are evicted right away
+func (cache *Cache) SetStreamLimit(stream string, limit int64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.limits[stream] = max(limit, 0)
+
+	for cache.usage[stream] > cache.limits[stream] {
+		element := cache.oldest(func(key Key) bool {
+			return key.Stream == stream
+		})
+
+		if element == nil {
+			break
+		}
+
+		cache.removeElement(element)
+	}
+}
+
+// ResetStreamLimit makes the stream follow the default stream limit again
+func (cache *Cache) ResetStreamLimit(stream string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.limits, stream)
+}
+
+func (cache *Cache) streamLimitOf(stream string) int64 {
+	if limit, ok := cache.limits[stream]; ok {
+		return limit
+	}
+
+	return cache.streamLimit
+}
+
+// Get returns the chunk from memory, falling back to the disk cache when enabled
+func (cache *Cache) Get(key Key) *Chunk {
+	cache.mu.Lock()
+	element, ok := cache.entries[key]
+	if ok {
+		cache.lru.MoveToFront(element)
+	}
+	cache.mu.Unlock()
+
+	if ok {
+		return element.Value.(*entry).chunk
+	}
+
+	if cache.disk == nil {
+		return nil
+	}
+
+	data, ok := cache.disk.Load(key)
+	if !ok {
+		return nil
+	}
+
+	chunk := NewCompleteChunk(data)
+
+	cache.Put(key, chunk)
+
+	return chunk
+}
+
+// Persist stores a complete chunk in the disk cache when enabled
+func (cache *Cache) Persist(key Key, chunk *Chunk) {
+	if cache.disk == nil || !chunk.IsComplete() {
+		return
+	}
+
+	go func() {
+		err := cache.disk.Store(key, chunk.Bytes())
+		if err != nil {
+			message := fmt.Sprintf("Failed to persist chunk %d of %s", key.Index, key.Stream)
+			cache.logger.Error(message, err)
+		}
+	}()
+}
+
+func (cache *Cache) Put(key Key, chunk *Chunk) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.removeElement(element)
+	}
+
+	cache.put(key, chunk)
+}
+
+// GetOrPut returns the chunk that is cached under the key, when there is none
+// the given chunk is stored and returned. Unlike Get followed by Put this is
+// atomic, so concurrent writers of a chunk always end up with the same one.
+func (cache *Cache) GetOrPut(key Key, chunk *Chunk) *Chunk {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if element, ok := cache.entries[key]; ok {
+		cache.lru.MoveToFront(element)
+		return element.Value.(*entry).chunk
+	}
+
+	cache.put(key, chunk)
+
+	return chunk
+}
+
+// put stores a chunk under a key that is not cached, the caller holds the lock
+func (cache *Cache) put(key Key, chunk *Chunk) {
+	element := cache.lru.PushFront(&entry{key: key, chunk: chunk})
+	cache.entries[key] = element
+
+	cache.size += chunk.Len()
+	cache.usage[key.Stream] += chunk.Len()
+
+	cache.evict(key)
+}
+
+// Remove drops every chunk of the stream from memory and disk
+func (cache *Cache) Remove(stream string) {
+	if cache.disk != nil {
+		cache.disk.RemoveStream(stream)
+	}
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	for element := cache.lru.Back(); element != nil; {
+		previous := element.Prev()
+
+		if element.Value.(*entry).key.Stream == stream {
+			cache.removeElement(element)
+		}
+
+		element = previous
+	}
+}
+
+func (cache *Cache) evict(keep Key) {
+	for cache.usage[keep.Stream] > cache.streamLimitOf(keep.Stream) {
+		element := cache.oldest(func(key Key) bool {
+			return key.Stream == keep.Stream && key != keep
+		})
+
+		if element == nil {
+			break
+		}
+
+		cache.removeElement(element)
+	}
+
+	for cache.size > cache.limit {
+		element := cache.oldest(func(key Key) bool {
+			return key != keep
+		})
+
+		if element == nil {
+			break
+		}
+
+		cache.removeElement(element)
+	}
+}
+
+func (cache *Cache) oldest(match func(Key) bool) *list.Element {
+	for element := cache.lru.Back(); element != nil; element = element.Prev() {
+		if match(element.Value.(*entry).key) {
+			return element
+		}
+	}
+
+	return nil
+}
+
+func (cache *Cache) removeElement(element *list.Element) {
+	entry := cache.lru.Remove(element).(*entry)
+
+	delete(cache.entries, entry.key)
+
+	cache.size -= entry.chunk.Len()
+	cache.usage[entry.key.Stream] -= entry.chunk.Len()
+
+	if cache.usage[entry.key.Stream] <= 0 {
+		delete(cache.usage, entry.key.Stream)
+	}
+}
@@ -0,0 +1,211 @@
+package cache
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"fuse_video_streamer/logger"
+)
+
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "cache")
+	if err != nil {
+		panic(err)
+	}
+
+	logger.LogDir = filepath.Join(directory, "logs")
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+const chunkSize = 10
+
+func put(cache *Cache, stream string, indexes ...int64) {
+	for _, index := range indexes {
+		cache.Put(Key{Stream: stream, Index: index}, NewCompleteChunk(make([]byte, chunkSize)))
+	}
+}
+
+// order returns the cached keys from the most to the least recently used
+// without touching them
+func order(cache *Cache) []Key {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	var keys []Key
+	for element := cache.lru.Front(); element != nil; element = element.Next() {
+		keys = append(keys, element.Value.(*entry).key)
+	}
+
+	return keys
+}
+
+func expectOrder(t *testing.T, cache *Cache, expected ...Key) {
+	t.Helper()
+
+	keys := order(cache)
+
+	if len(keys) != len(expected) {
+		t.Fatalf("got %v, expected %v", keys, expected)
+	}
+
+	for i := range keys {
+		if keys[i] != expected[i] {
+			t.Fatalf("got %v, expected %v", keys, expected)
+		}
+	}
+}
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := New(chunkSize, 3*chunkSize, 3*chunkSize)
+
+	put(cache, "a", 0, 1, 2)
+
+	if cache.Get(Key{Stream: "a", Index: 0}) == nil {
+		t.Fatalf("chunk 0 is not cached")
+	}
+
+	put(cache, "a", 3)
+
+	// Chunk 1 was used least recently since chunk 0 was read again
+	expectOrder(t, cache, Key{"a", 3}, Key{"a", 0}, Key{"a", 2})
+
+	put(cache, "a", 4)
+
+	expectOrder(t, cache, Key{"a", 4}, Key{"a", 3}, Key{"a", 0})
+
+	if cache.Get(Key{Stream: "a", Index: 1}) != nil {
+		t.Fatalf("evicted chunk 1 is still returned")
+	}
+
+	if cache.size != 3*chunkSize || cache.usage["a"] != 3*chunkSize {
+		t.Fatalf("got size %d and usage %d", cache.size, cache.usage["a"])
+	}
+}
+
+func TestPutReplacesChunk(t *testing.T) {
+	cache := New(chunkSize, 3*chunkSize, 3*chunkSize)
+
+	put(cache, "a", 0, 1, 0)
+
+	expectOrder(t, cache, Key{"a", 0}, Key{"a", 1})
+
+	if cache.size != 2*chunkSize {
+		t.Fatalf("replaced chunk is counted twice, size is %d", cache.size)
+	}
+}
+
+func TestGetOrPutKeepsFirstChunk(t *testing.T) {
+	cache := New(chunkSize, 100*chunkSize, 100*chunkSize)
+	key := Key{Stream: "a", Index: 0}
+
+	chunks := make([]*Chunk, 50)
+
+	var wg sync.WaitGroup
+	for i := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			chunks[i] = cache.GetOrPut(key, NewChunk(chunkSize))
+		}()
+	}
+	wg.Wait()
+
+	for _, chunk := range chunks {
+		if chunk != chunks[0] {
+			t.Fatalf("concurrent writers got different chunks")
+		}
+	}
+
+	if cache.Get(key) != chunks[0] || cache.size != chunkSize {
+		t.Fatalf("the cache holds another chunk, size is %d", cache.size)
+	}
+
+	put(cache, "a", 1)
+
+	// An existing chunk is used again
+	if cache.GetOrPut(key, NewChunk(chunkSize)) != chunks[0] {
+		t.Fatalf("the cached chunk was replaced")
+	}
+
+	expectOrder(t, cache, Key{"a", 0}, Key{"a", 1})
+}
+
+func TestStreamLimitEvictsOwnChunks(t *testing.T) {
+	cache := New(chunkSize, 10*chunkSize, 2*chunkSize)
+
+	put(cache, "a", 0)
+	put(cache, "b", 0)
+	put(cache, "a", 1, 2)
+
+	// The chunk of b is older but only a is above its limit
+	expectOrder(t, cache, Key{"a", 2}, Key{"a", 1}, Key{"b", 0})
+}
+
+func TestGlobalLimitEvictsOtherStreams(t *testing.T) {
+	cache := New(chunkSize, 3*chunkSize, 3*chunkSize)
+
+	put(cache, "a", 0)
+	put(cache, "b", 0)
+	put(cache, "a", 1)
+	put(cache, "b", 1)
+
+	expectOrder(t, cache, Key{"b", 1}, Key{"a", 1}, Key{"b", 0})
+
+	if _, ok := cache.usage["a"]; !ok || cache.usage["a"] != chunkSize {
+		t.Fatalf("got usage %d of a", cache.usage["a"])
+	}
+}
+
+func TestSetStreamLimit(t *testing.T) {
+	cache := New(chunkSize, 10*chunkSize, 5*chunkSize)
+
+	put(cache, "a", 0, 1, 2)
+	put(cache, "b", 0)
+
+	cache.SetStreamLimit("a", chunkSize)
+
+	expectOrder(t, cache, Key{"b", 0}, Key{"a", 2})
+
+	put(cache, "a", 3)
+
+	expectOrder(t, cache, Key{"a", 3}, Key{"b", 0})
+
+	cache.ResetStreamLimit("a")
+
+	put(cache, "a", 4)
+
+	expectOrder(t, cache, Key{"a", 4}, Key{"a", 3}, Key{"b", 0})
+}
+
+func TestKeepsChunkLargerThanLimit(t *testing.T) {
+	cache := New(chunkSize, 3*chunkSize, 3*chunkSize)
+
+	put(cache, "a", 0)
+
+	key := Key{Stream: "a", Index: 1}
+	cache.Put(key, NewCompleteChunk(make([]byte, 5*chunkSize)))
+
+	// The chunk that was just stored is never evicted by its own Put
+	expectOrder(t, cache, key)
+}
+
+func TestRemove(t *testing.T) {
+	cache := New(chunkSize, 10*chunkSize, 10*chunkSize)
+
+	put(cache, "a", 0, 1)
+	put(cache, "b", 0)
+
+	cache.Remove("a")
+
+	expectOrder(t, cache, Key{"b", 0})
+
+	if _, ok := cache.usage["a"]; ok || cache.size != chunkSize {
+		t.Fatalf("got size %d and usage %v", cache.size, cache.usage)
+	}
+}
@@ -0,0 +1,129 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"fuse_video_streamer/stream/connection"
+)
+
+// Generation of the chunks of every stream key, a key moves to the next one
+// when its remote file changed so chunks that writers of the old version store
+// late can not be read by the streams of the new version
+var generations = make(map[string]uint64)
+var generationsMu sync.Mutex
+
+// chunkStream returns the name the chunks of the key are cached under
+func chunkStream(key string) string {
+	generationsMu.Lock()
+	defer generationsMu.Unlock()
+
+	generation := generations[key]
+	if generation == 0 {
+		return key
+	}
+
+	return fmt.Sprintf("%s#%d", key, generation)
+}
+
+func nextGeneration(key string) {
+	generationsMu.Lock()
+	defer generationsMu.Unlock()
+
+	generations[key]++
+}
+
+// IsChanged reports whether a read failed because the remote file changed
+// while it was streamed
+func IsChanged(err error) bool {
+	var changedError *connection.ChangedError
+	return errors.As(err, &changedError)
+}
+
+// verify compares every response with the size of the stream, the ETag of its
+// descriptor and the earlier responses of the same url
+func (stream *Stream) verify(source connection.Source, identity connection.Identity) error {
+	if identity.Size >= 0 && identity.Size != stream.size {
+		return stream.markChanged(fmt.Sprintf("size is %d instead of %d", identity.Size, stream.size))
+	}
+
+	stream.resolveMu.Lock()
+	expected := stream.descriptor.ETag
+	stream.resolveMu.Unlock()
+
+	if expected != "" && identity.ETag != "" && normalizeETag(expected) != normalizeETag(identity.ETag) {
+		return stream.markChanged(fmt.Sprintf("ETag is %s instead of %s", identity.ETag, expected))
+	}
+
+	stream.identitiesMu.Lock()
+	defer stream.identitiesMu.Unlock()
+
+	known, ok := stream.identities[source.Url]
+	if !ok {
+		stream.identities[source.Url] = identity
+		return nil
+	}
+
+	if known.ETag != "" && identity.ETag != "" && known.ETag != identity.ETag {
+		return stream.markChanged(fmt.Sprintf("ETag is %s instead of %s", identity.ETag, known.ETag))
+	}
+
+	if known.LastModified != "" && identity.LastModified != "" && known.LastModified != identity.LastModified {
+		return stream.markChanged(fmt.Sprintf("last modified at %s instead of %s", identity.LastModified, known.LastModified))
+	}
+
+	return nil
+}
+
+// markChanged fails the stream, the cached chunks belong to another version
+// of the file so they are removed and the next stream of the file caches its
+// chunks under a new generation
+func (stream *Stream) markChanged(reason string) error {
+	changedError := &connection.ChangedError{Reason: reason}
+
+	if !stream.changed.CompareAndSwap(nil, changedError) {
+		return stream.changed.Load()
+	}
+
+	stream.logger.Error(fmt.Sprintf("Remote file of %s changed, failing its readers", stream.key), changedError)
+
+	nextGeneration(stream.key)
+
+	streams.CompareAndDelete(stream.key, stream)
+	stream.cache.Remove(stream.chunks)
+
+	stream.broadcast()
+
+	// The next stream of the file must not start from the outdated descriptor
+	go func() {
+		_, err := stream.resolve(context.Background(), true)
+		if err != nil {
+			stream.logger.Error(fmt.Sprintf("Failed to refresh the descriptor of %s", stream.key), err)
+		}
+	}()
+
+	return changedError
+}
+
+func (stream *Stream) isChanged() bool {
+	return stream.changed.Load() != nil
+}
+
+// changedError returns the error readers fail with once the file changed
+func (stream *Stream) changedError() error {
+	changedError := stream.changed.Load()
+	if changedError == nil {
+		return nil
+	}
+
+	return fmt.Errorf("stream %s: %w", stream.key, changedError)
+}
+
+// normalizeETag removes the weak prefix, ranges of the same file may be
+// served with a weak and a strong tag by different edges
+func normalizeETag(etag string) string {
+	return strings.TrimPrefix(strings.TrimSpace(etag), "W/")
+}
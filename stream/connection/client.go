@@ -0,0 +1,178 @@
+package connection
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"fuse_video_streamer/config"
+)
+
+const (
+	DefaultDialTimeout           = 10 * time.Second
+	DefaultResponseHeaderTimeout = 30 * time.Second
+
+	// A body that delivers no bytes for this long is treated as dropped
+	DefaultStallTimeout = 5 * time.Second
+)
+
+// Client is the HTTP client shared by every connection of a provider, so
+// keep-alive connections and TLS sessions are reused across seeks
+type Client struct {
+	http         *http.Client
+	userAgent    string
+	stallTimeout time.Duration
+}
+
+// providerClient is the client of a provider together with the config it
+// was built from, so a reloaded config can be told apart
+type providerClient struct {
+	client  *Client
+	options config.HTTP
+}
+
+var clients = make(map[string]providerClient)
+var clientsMu sync.Mutex
+
+var defaultClient *Client
+var defaultClientErr error
+var defaultClientOnce sync.Once
+
+// GetClient returns the client of the provider configured by its file server
+// entry, the client is created on first use and again whenever the http
+// config of the provider changed. Connections that are already open keep
+// the client they were opened with.
+func GetClient(provider string) (*Client, error) {
+	clientsMu.Lock()
+	defer clientsMu.Unlock()
+
+	fileServer, _ := config.GetFileServer(provider)
+
+	existing, ok := clients[provider]
+	if ok && existing.options == fileServer.HTTP {
+		return existing.client, nil
+	}
+
+	client, err := NewClient(fileServer.HTTP)
+	if err != nil {
+		return nil, fmt.Errorf("invalid http config of %s: %w", provider, err)
+	}
+
+	if ok {
+		existing.client.http.CloseIdleConnections()
+	}
+
+	clients[provider] = providerClient{
+		client:  client,
+		options: fileServer.HTTP,
+	}
+
+	return client, nil
+}
+
+func getDefaultClient() (*Client, error) {
+	defaultClientOnce.Do(func() {
+		defaultClient, defaultClientErr = NewClient(config.HTTP{})
+	})
+
+	if defaultClientErr != nil {
+		return nil, fmt.Errorf("invalid default http config: %w", defaultClientErr)
+	}
+
+	return defaultClient, nil
+}
+
+func NewClient(options config.HTTP) (*Client, error) {
+	tlsConfig := &tls.Config{
+		ClientSessionCache: tls.NewLRUClientSessionCache(100),
+		InsecureSkipVerify: options.InsecureSkipVerify,
+	}
+
+	if options.CABundle != "" {
+		bundle, err := os.ReadFile(options.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+		}
+
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+
+		if !pool.AppendCertsFromPEM(bundle) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", options.CABundle)
+		}
+
+		tlsConfig.RootCAs = pool
+	}
+
+	if options.ClientCertificate != "" || options.ClientKey != "" {
+		certificate, err := tls.LoadX509KeyPair(options.ClientCertificate, options.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+
+	proxy := http.ProxyFromEnvironment
+	if options.Proxy != "" {
+		proxyUrl, err := url.Parse(options.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+
+		proxy = http.ProxyURL(proxyUrl)
+	}
+
+	dialTimeout := DefaultDialTimeout
+	if options.DialTimeoutSeconds > 0 {
+		dialTimeout = time.Duration(options.DialTimeoutSeconds * float64(time.Second))
+	}
+
+	responseHeaderTimeout := DefaultResponseHeaderTimeout
+	if options.ResponseHeaderTimeoutSeconds > 0 {
+		responseHeaderTimeout = time.Duration(options.ResponseHeaderTimeoutSeconds * float64(time.Second))
+	}
+
+	stallTimeout := DefaultStallTimeout
+	if options.StallTimeoutSeconds > 0 {
+		stallTimeout = time.Duration(options.StallTimeoutSeconds * float64(time.Second))
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   dialTimeout,
+		KeepAlive: 30 * time.Second,
+	}
+
+	transport := &http.Transport{
+		TLSClientConfig:       tlsConfig,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		MaxConnsPerHost:       32,
+		MaxIdleConnsPerHost:   16,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+		DisableCompression:    true,
+		Proxy:                 proxy,
+	}
+
+	client := &Client{
+		http: &http.Client{
+			Transport: transport,
+			Timeout:   4 * time.Hour,
+		},
+		userAgent:    options.UserAgent,
+		stallTimeout: stallTimeout,
+	}
+
+	return client, nil
+}
@@ -0,0 +1,73 @@
+package connection
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestMain runs the tests in a directory with a config file the tests rewrite
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "connection")
+	if err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(directory); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+func writeConfig(t *testing.T, http string) {
+	t.Helper()
+
+	config := "mount_point: /tmp/fvs\nvolume_name: fvs\nfile_servers:\n  - name: provider\n    http:\n" + http
+	if err := os.WriteFile("config.yml", []byte(config), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getClient(t *testing.T) *Client {
+	t.Helper()
+
+	client, err := GetClient("provider")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return client
+}
+
+func TestGetClientFollowsConfigReloads(t *testing.T) {
+	writeConfig(t, "      user_agent: first\n")
+
+	client := getClient(t)
+	if client.userAgent != "first" {
+		t.Fatalf("got user agent %q", client.userAgent)
+	}
+
+	if getClient(t) != client {
+		t.Fatalf("the client was rebuilt although the config did not change")
+	}
+
+	writeConfig(t, "      user_agent: second\n      stall_timeout_seconds: 2\n")
+
+	reloaded := getClient(t)
+	if reloaded == client || reloaded.userAgent != "second" || reloaded.stallTimeout != 2*time.Second {
+		t.Fatalf("the reloaded config was not applied, got user agent %q and stall timeout %s", reloaded.userAgent, reloaded.stallTimeout)
+	}
+}
+
+func TestGetClientRejectsInvalidConfig(t *testing.T) {
+	writeConfig(t, "      ca_bundle: "+filepath.Join(t.TempDir(), "missing.pem")+"\n")
+
+	if client, err := GetClient("provider"); err == nil {
+		t.Fatalf("expected an error for a missing CA bundle, got %+v", client)
+	}
+}
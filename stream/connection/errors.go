@@ -0,0 +1,86 @@
+package connection
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// StatusError is returned when the server responds with an unexpected status
+type StatusError struct {
+	StatusCode int
+}
+
+func (err *StatusError) Error() string {
+	return fmt.Sprintf("failed to get partial content: %d", err.StatusCode)
+}
+
+// ChangedError is returned when a response belongs to another version of the
+// remote file than the earlier responses of the stream
+type ChangedError struct {
+	Reason string
+}
+
+func (err *ChangedError) Error() string {
+	return fmt.Sprintf("remote file changed: %s", err.Reason)
+}
+
+// IsRetryable reports whether the request may succeed when it is repeated,
+// transport failures and temporary server errors are retryable while other
+// statuses and cancellations are fatal
+func IsRetryable(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var contentError *ContentError
+	if errors.As(err, &contentError) {
+		return false
+	}
+
+	var changedError *ChangedError
+	if errors.As(err, &changedError) {
+		return false
+	}
+
+	var statusError *StatusError
+	if errors.As(err, &statusError) {
+		switch statusError.StatusCode {
+		case http.StatusRequestTimeout,
+			http.StatusTooManyRequests,
+			http.StatusInternalServerError,
+			http.StatusBadGateway,
+			http.StatusServiceUnavailable,
+			http.StatusGatewayTimeout:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// Everything else failed in the transport, like a reset connection, a
+	// timeout or a body that ended before its content length
+	return true
+}
+
+// IsExpired reports whether the server rejected the url itself, which is how
+// expired or revoked stream links fail, hosts also serve error pages for them
+func IsExpired(err error) bool {
+	var contentError *ContentError
+	if errors.As(err, &contentError) {
+		return true
+	}
+
+	var statusError *StatusError
+	if !errors.As(err, &statusError) {
+		return false
+	}
+
+	switch statusError.StatusCode {
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return true
+	default:
+		return false
+	}
+}
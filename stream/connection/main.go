@@ -2,7 +2,6 @@ package connection
 
 import (
 	"context"
-	"crypto/tls"
 	"fmt"
 	"io"
 	"net/http"
@@ -13,9 +12,25 @@ import (
 
 var _ io.ReadCloser = &Connection{}
 
+// Source is a url together with the headers every request to it needs and
+// the client of its provider, the default client is used when it is nil
+type Source struct {
+	Url     string
+	Headers map[string]string
+
+	Client *Client
+}
+
+// Verifier checks the identity of every response of a stream
+type Verifier func(source Source, identity Identity) error
+
 type Connection struct {
-	url           string
+	source        Source
 	startPosition int64
+	endPosition   int64
+
+	identity Identity
+	verify   Verifier
 
 	context context.Context
 	cancel  context.CancelFunc
@@ -27,16 +42,27 @@ type Connection struct {
 	closed atomic.Bool
 }
 
-func NewConnection(url string, startPosition int64) (*Connection, error) {
+func NewConnection(source Source, startPosition int64) (*Connection, error) {
+	return NewRangeConnection(source, startPosition, -1)
+}
+
+// NewRangeConnection requests the bytes up to and including the end position,
+// a negative end position requests the rest of the file
+func NewRangeConnection(source Source, startPosition int64, endPosition int64) (*Connection, error) {
 	if startPosition < 0 {
 		return nil, fmt.Errorf("invalid seek position: %d", startPosition)
 	}
 
+	if endPosition >= 0 && endPosition < startPosition {
+		return nil, fmt.Errorf("invalid range: %d-%d", startPosition, endPosition)
+	}
+
 	connectionContext, connectionCancel := context.WithCancel(context.Background())
 
 	connection := &Connection{
-		url:           url,
+		source:        source,
 		startPosition: startPosition,
+		endPosition:   endPosition,
 		context:       connectionContext,
 		cancel:        connectionCancel,
 	}
@@ -44,6 +70,54 @@ func NewConnection(url string, startPosition int64) (*Connection, error) {
 	return connection, nil
 }
 
+func (connection *Connection) Source() Source {
+	return connection.source
+}
+
+// SetVerifier checks every response before it is read, it is kept when the
+// connection is resumed
+func (connection *Connection) SetVerifier(verify Verifier) {
+	connection.verify = verify
+}
+
+func (connection *Connection) client() (*Client, error) {
+	if connection.source.Client != nil {
+		return connection.source.Client, nil
+	}
+
+	return getDefaultClient()
+}
+
+// StallTimeout is how long the opened body may deliver no bytes before the
+// connection is treated as dropped
+func (connection *Connection) StallTimeout() time.Duration {
+	client, err := connection.client()
+	if err != nil {
+		return DefaultStallTimeout
+	}
+
+	return client.stallTimeout
+}
+
+// Resume returns a new connection on the source for the same range that
+// continues after the given amount of bytes have been received
+func (connection *Connection) Resume(source Source, received int64) (*Connection, error) {
+	startPosition := connection.startPosition + received
+
+	if connection.endPosition >= 0 && startPosition > connection.endPosition {
+		return nil, fmt.Errorf("range %d-%d is already complete", connection.startPosition, connection.endPosition)
+	}
+
+	resumed, err := NewRangeConnection(source, startPosition, connection.endPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	resumed.verify = connection.verify
+
+	return resumed, nil
+}
+
 func (connection *Connection) Read(buf []byte) (int, error) {
 	if connection.closed.Load() {
 		return 0, nil
@@ -57,50 +131,128 @@ func (connection *Connection) Read(buf []byte) (int, error) {
 		return body.Read(buf)
 	}
 
+	err := connection.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	connection.mu.RLock()
+	body = connection.body
+	connection.mu.RUnlock()
+
+	if body == nil {
+		return 0, nil
+	}
+
+	return body.Read(buf)
+}
+
+// Open sends the request and waits for the response headers, reading opens
+// the connection when this was not done before
+func (connection *Connection) Open() error {
 	connection.mu.Lock()
 	defer connection.mu.Unlock()
 
-	if connection.closed.Load() {
-		return 0, nil
+	if connection.closed.Load() || connection.body != nil {
+		return nil
+	}
+
+	request, err := http.NewRequestWithContext(connection.context, "GET", connection.source.Url, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request")
 	}
 
-	request, err := http.NewRequestWithContext(connection.context, "GET", connection.url, nil)
+	client, err := connection.client()
 	if err != nil {
-		return 0, fmt.Errorf("failed to create request")
+		return err
+	}
+
+	if client.userAgent != "" {
+		request.Header.Set("User-Agent", client.userAgent)
+	}
+
+	for key, value := range connection.source.Headers {
+		request.Header.Set(key, value)
 	}
 
 	rangeHeader := fmt.Sprintf("bytes=%d-", connection.startPosition)
+	if connection.endPosition >= 0 {
+		rangeHeader = fmt.Sprintf("bytes=%d-%d", connection.startPosition, connection.endPosition)
+	}
 	request.Header.Set("Range", rangeHeader)
 
-	client := &http.Client{
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{
-				ClientSessionCache: tls.NewLRUClientSessionCache(100),
-			},
-			ForceAttemptHTTP2:   true,
-			MaxIdleConns:        100,
-			MaxConnsPerHost:     10,
-			MaxIdleConnsPerHost: 3,
-			IdleConnTimeout:     90 * time.Second,
-			DisableCompression:  true,
-			Proxy:               http.ProxyFromEnvironment,
-		},
-		Timeout: 4 * time.Hour,
-	}
-
-	response, err := client.Do(request)
+	response, err := client.http.Do(request)
 	if err != nil {
-		return 0, fmt.Errorf("failed to do request: %v", err)
+		return fmt.Errorf("failed to do request: %w", err)
 	}
 
 	// Some systems like zurg use 200 status code for partial content
 	if response.StatusCode != http.StatusPartialContent && response.StatusCode != http.StatusOK {
-		return 0, fmt.Errorf("failed to get partial content: %d", response.StatusCode)
+		response.Body.Close()
+		return &StatusError{StatusCode: response.StatusCode}
+	}
+
+	body, err := connection.validate(response)
+	if err != nil {
+		response.Body.Close()
+		return err
+	}
+
+	if connection.verify != nil {
+		err = connection.verify(connection.source, connection.identity)
+		if err != nil {
+			response.Body.Close()
+			return err
+		}
+	}
+
+	connection.body = body
+
+	return nil
+}
+
+// Race opens the connections at once and returns the first one that responds,
+// the other connections are closed
+func Race(connections []*Connection) (*Connection, error) {
+	type result struct {
+		connection *Connection
+		err        error
+	}
+
+	results := make(chan result, len(connections))
+
+	for _, connection := range connections {
+		go func() {
+			results <- result{connection, connection.Open()}
+		}()
+	}
+
+	var winner *Connection
+	lastErr := fmt.Errorf("all connections were closed")
+
+	for range connections {
+		result := <-results
+		if result.err == nil && !result.connection.isClosed() {
+			winner = result.connection
+			break
+		}
+
+		if result.err != nil {
+			lastErr = result.err
+		}
+	}
+
+	for _, connection := range connections {
+		if connection != winner {
+			connection.Close()
+		}
 	}
 
-	connection.body = response.Body
+	if winner == nil {
+		return nil, lastErr
+	}
 
-	return response.Body.Read(buf)
+	return winner, nil
 }
 
 func (connection *Connection) Close() error {
@@ -110,6 +262,9 @@ func (connection *Connection) Close() error {
 
 	connection.cancel()
 
+	connection.mu.Lock()
+	defer connection.mu.Unlock()
+
 	if connection.body != nil {
 		err := connection.body.Close()
 		if err != nil {
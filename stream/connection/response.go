@@ -0,0 +1,216 @@
+package connection
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentError is returned when the response does not contain the file, like
+// an error page that a host serves with a success status
+type ContentError struct {
+	ContentType string
+}
+
+func (err *ContentError) Error() string {
+	return fmt.Sprintf("response is not media content: %s", err.ContentType)
+}
+
+// RangeError is returned when the response covers a different range than requested
+type RangeError struct {
+	Requested int64
+	Received  int64
+}
+
+func (err *RangeError) Error() string {
+	return fmt.Sprintf("requested range at %d but received %d", err.Requested, err.Received)
+}
+
+// Identity describes the version of the remote file a response belongs to,
+// Size is negative when the response does not tell the size of the file
+type Identity struct {
+	ETag         string
+	LastModified string
+	Size         int64
+}
+
+// body reads at most the remaining bytes of the requested range and reports
+// a body that ends early as an unexpected EOF so the transfer resumes it
+type body struct {
+	io.Reader
+	io.Closer
+
+	// Negative when the length of the range is unknown
+	remaining int64
+}
+
+func (body *body) Read(p []byte) (int, error) {
+	if body.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	if body.remaining > 0 && int64(len(p)) > body.remaining {
+		p = p[:body.remaining]
+	}
+
+	n, err := body.Reader.Read(p)
+
+	if body.remaining > 0 {
+		body.remaining -= int64(n)
+
+		if err == io.EOF && body.remaining > 0 {
+			return n, io.ErrUnexpectedEOF
+		}
+	}
+
+	return n, err
+}
+
+// validate checks that the response holds the requested range of the file
+// and returns the body positioned at the start of the range
+func (connection *Connection) validate(response *http.Response) (io.ReadCloser, error) {
+	remaining := int64(-1)
+	if connection.endPosition >= 0 {
+		remaining = connection.endPosition - connection.startPosition + 1
+	}
+
+	reader := bufio.NewReader(response.Body)
+
+	err := checkContentType(response, reader)
+	if err != nil {
+		return nil, err
+	}
+
+	connection.identity = Identity{
+		ETag:         response.Header.Get("ETag"),
+		LastModified: response.Header.Get("Last-Modified"),
+		Size:         -1,
+	}
+
+	contentRange := response.Header.Get("Content-Range")
+
+	switch {
+	case contentRange != "":
+		start, end, size, err := parseContentRange(contentRange)
+		if err != nil {
+			return nil, err
+		}
+
+		connection.identity.Size = size
+
+		if start != connection.startPosition {
+			return nil, &RangeError{Requested: connection.startPosition, Received: start}
+		}
+
+		if remaining < 0 || end-start+1 < remaining {
+			remaining = end - start + 1
+		}
+
+	case response.StatusCode == http.StatusOK && connection.startPosition > 0 && isFullBody(response, remaining):
+		// The server ignored the range, skip forward to the requested position
+		connection.identity.Size = response.ContentLength
+
+		_, err := io.CopyN(io.Discard, reader, connection.startPosition)
+		if err != nil {
+			return nil, fmt.Errorf("failed to skip to %d of a full response: %w", connection.startPosition, err)
+		}
+
+	case response.StatusCode == http.StatusPartialContent && response.ContentLength >= 0 && remaining >= 0 && response.ContentLength != remaining:
+		return nil, fmt.Errorf("requested %d bytes but the response has %d", remaining, response.ContentLength)
+	}
+
+	return &body{Reader: reader, Closer: response.Body, remaining: remaining}, nil
+}
+
+// isFullBody reports whether a response without Content-Range holds the whole
+// file instead of the requested range, some systems like zurg answer a range
+// with status 200 and only the requested bytes
+func isFullBody(response *http.Response, remaining int64) bool {
+	acceptRanges := response.Header.Get("Accept-Ranges")
+
+	if acceptRanges == "none" {
+		return true
+	}
+
+	if response.ContentLength >= 0 && remaining >= 0 {
+		return response.ContentLength > remaining
+	}
+
+	// Without a length only servers that claim range support are trusted
+	return acceptRanges != "bytes"
+}
+
+// parseContentRange returns the start, end and size of the file, the size is
+// negative when the server does not know it
+func parseContentRange(value string) (int64, int64, int64, error) {
+	invalid := fmt.Errorf("invalid Content-Range: %s", value)
+
+	// bytes <start>-<end>/<size or *>
+	value, found := strings.CutPrefix(strings.TrimSpace(value), "bytes ")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+
+	span, sizeValue, _ := strings.Cut(value, "/")
+
+	startValue, endValue, found := strings.Cut(span, "-")
+	if !found {
+		return 0, 0, 0, invalid
+	}
+
+	start, err := strconv.ParseInt(startValue, 10, 64)
+	if err != nil {
+		return 0, 0, 0, invalid
+	}
+
+	end, err := strconv.ParseInt(endValue, 10, 64)
+	if err != nil || end < start {
+		return 0, 0, 0, invalid
+	}
+
+	size := int64(-1)
+	if sizeValue != "" && sizeValue != "*" {
+		size, err = strconv.ParseInt(sizeValue, 10, 64)
+		if err != nil || size <= end {
+			return 0, 0, 0, invalid
+		}
+	}
+
+	return start, end, size, nil
+}
+
+// checkContentType rejects error pages, the content is sniffed when the server
+// does not send a type
+func checkContentType(response *http.Response, reader *bufio.Reader) error {
+	contentType := response.Header.Get("Content-Type")
+
+	if contentType == "" {
+		head, _ := reader.Peek(512)
+		if len(head) == 0 {
+			return nil
+		}
+
+		contentType = http.DetectContentType(head)
+
+		// Binary media is not recognised by the sniffer, only reject markup
+		if !strings.HasPrefix(contentType, "text/html") && !strings.HasPrefix(contentType, "text/xml") {
+			return nil
+		}
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil
+	}
+
+	switch mediaType {
+	case "text/html", "text/xml", "application/xhtml+xml", "application/json", "application/problem+json":
+		return &ContentError{ContentType: mediaType}
+	default:
+		return nil
+	}
+}
@@ -0,0 +1,207 @@
+package connection
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		value string
+
+		start int64
+		end   int64
+		size  int64
+		valid bool
+	}{
+		{value: "bytes 0-99/1000", start: 0, end: 99, size: 1000, valid: true},
+		{value: " bytes 100-199/1000 ", start: 100, end: 199, size: 1000, valid: true},
+		{value: "bytes 0-0/1", start: 0, end: 0, size: 1, valid: true},
+		{value: "bytes 0-99/*", start: 0, end: 99, size: -1, valid: true},
+		{value: "bytes 0-99", start: 0, end: 99, size: -1, valid: true},
+
+		{value: ""},
+		{value: "0-99/1000"},
+		{value: "items 0-99/1000"},
+		{value: "bytes */1000"},
+		{value: "bytes 0/1000"},
+		{value: "bytes -5-99/1000"},
+		{value: "bytes a-99/1000"},
+		{value: "bytes 0-b/1000"},
+		{value: "bytes 99-0/1000"},
+		{value: "bytes 0-99/size"},
+		{value: "bytes 0-99/-1"},
+		{value: "bytes 0-99/99"},
+		{value: "bytes 0-99999999999999999999/1000"},
+	}
+
+	for _, test := range tests {
+		start, end, size, err := parseContentRange(test.value)
+
+		if !test.valid {
+			if err == nil {
+				t.Errorf("%q: expected an error, got %d-%d/%d", test.value, start, end, size)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", test.value, err)
+			continue
+		}
+
+		if start != test.start || end != test.end || size != test.size {
+			t.Errorf("%q: got %d-%d/%d, expected %d-%d/%d", test.value, start, end, size, test.start, test.end, test.size)
+		}
+	}
+}
+
+func newResponse(status int, header map[string]string, content string) *http.Response {
+	response := &http.Response{
+		StatusCode:    status,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(strings.NewReader(content)),
+		ContentLength: int64(len(content)),
+	}
+
+	for key, value := range header {
+		response.Header.Set(key, value)
+	}
+
+	return response
+}
+
+func TestValidate(t *testing.T) {
+	content := "0123456789"
+
+	tests := []struct {
+		name     string
+		start    int64
+		end      int64
+		response *http.Response
+
+		expected string
+		err      error
+	}{
+		{
+			name:     "partial content",
+			start:    2,
+			end:      5,
+			response: newResponse(http.StatusPartialContent, map[string]string{"Content-Range": "bytes 2-5/10"}, content[2:6]),
+			expected: "2345",
+		},
+		{
+			name:     "open ended range",
+			start:    8,
+			end:      -1,
+			response: newResponse(http.StatusPartialContent, map[string]string{"Content-Range": "bytes 8-9/10"}, content[8:]),
+			expected: "89",
+		},
+		{
+			name:     "range ignored by the server",
+			start:    4,
+			end:      6,
+			response: newResponse(http.StatusOK, nil, content),
+			expected: "456",
+		},
+		{
+			name:     "status 200 with only the requested bytes",
+			start:    4,
+			end:      6,
+			response: newResponse(http.StatusOK, map[string]string{"Accept-Ranges": "bytes"}, content[4:7]),
+			expected: "456",
+		},
+		{
+			name:     "mismatched start",
+			start:    2,
+			end:      5,
+			response: newResponse(http.StatusPartialContent, map[string]string{"Content-Range": "bytes 0-3/10"}, content[:4]),
+			err:      &RangeError{},
+		},
+		{
+			name:     "malformed Content-Range",
+			start:    2,
+			end:      5,
+			response: newResponse(http.StatusPartialContent, map[string]string{"Content-Range": "bytes 2-x/10"}, content[2:6]),
+			err:      errors.New("invalid Content-Range"),
+		},
+		{
+			name:     "length differs from the range",
+			start:    2,
+			end:      5,
+			response: newResponse(http.StatusPartialContent, nil, content[2:8]),
+			err:      errors.New("requested 4 bytes"),
+		},
+		{
+			name:     "error page",
+			start:    0,
+			end:      9,
+			response: newResponse(http.StatusOK, map[string]string{"Content-Type": "text/html; charset=utf-8"}, "<html></html>"),
+			err:      &ContentError{},
+		},
+		{
+			name:     "sniffed error page",
+			start:    0,
+			end:      9,
+			response: newResponse(http.StatusOK, nil, "<!DOCTYPE html><html><body>expired</body></html>"),
+			err:      &ContentError{},
+		},
+	}
+
+	for _, test := range tests {
+		connection := &Connection{startPosition: test.start, endPosition: test.end}
+
+		body, err := connection.validate(test.response)
+
+		if test.err != nil {
+			switch expected := test.err.(type) {
+			case *RangeError:
+				if !errors.As(err, &expected) {
+					t.Errorf("%s: expected a range error, got %v", test.name, err)
+				}
+			case *ContentError:
+				if !errors.As(err, &expected) {
+					t.Errorf("%s: expected a content error, got %v", test.name, err)
+				}
+			default:
+				if err == nil || !strings.Contains(err.Error(), expected.Error()) {
+					t.Errorf("%s: expected %q, got %v", test.name, expected, err)
+				}
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Errorf("%s: failed to read body: %v", test.name, err)
+			continue
+		}
+
+		if string(data) != test.expected {
+			t.Errorf("%s: got %q, expected %q", test.name, data, test.expected)
+		}
+	}
+}
+
+func TestBodyEndingEarly(t *testing.T) {
+	body := &body{Reader: strings.NewReader("0123"), Closer: io.NopCloser(nil), remaining: 8}
+
+	data, err := io.ReadAll(body)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("expected an unexpected EOF, got %v", err)
+	}
+
+	if len(data) != 4 {
+		t.Fatalf("expected the 4 received bytes, got %d", len(data))
+	}
+}
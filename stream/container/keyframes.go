@@ -0,0 +1,273 @@
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"sort"
+)
+
+const (
+	cuePointId           = 0xBB
+	cueTrackPositionsId  = 0xB7
+	cueClusterPositionId = 0xF1
+)
+
+// ParseKeyframes reads the byte offsets of the keyframes from the index data
+// which must contain the complete index range of the info
+func (info *Info) ParseKeyframes(index []byte) error {
+	if int64(len(index)) < info.Index.Length {
+		return fmt.Errorf("index is incomplete")
+	}
+
+	var keyframes []int64
+	var err error
+
+	switch info.Format {
+	case MP4:
+		keyframes, err = parseMP4Keyframes(index)
+	case Matroska:
+		keyframes, err = parseMatroskaKeyframes(index, info.base)
+	default:
+		return fmt.Errorf("unknown container")
+	}
+
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(keyframes, func(i, j int) bool {
+		return keyframes[i] < keyframes[j]
+	})
+
+	info.Keyframes = keyframes
+
+	return nil
+}
+
+// NearestKeyframe returns the offset of the last keyframe at or before the position
+func (info *Info) NearestKeyframe(position int64) (int64, bool) {
+	i := sort.Search(len(info.Keyframes), func(i int) bool {
+		return info.Keyframes[i] > position
+	})
+
+	if i == 0 {
+		return 0, false
+	}
+
+	return info.Keyframes[i-1], true
+}
+
+type box struct {
+	kind string
+	data []byte
+}
+
+func parseBoxes(data []byte) []box {
+	var boxes []box
+
+	for offset := 0; offset+8 <= len(data); {
+		header, err := parseBoxHeader(data[offset:], int64(len(data)-offset))
+		if err != nil {
+			break
+		}
+
+		boxes = append(boxes, box{
+			kind: header.kind,
+			data: data[offset+int(header.headerSize) : offset+int(header.size)],
+		})
+
+		offset += int(header.size)
+	}
+
+	return boxes
+}
+
+func findBox(data []byte, path ...string) []byte {
+	for _, kind := range path {
+		found := false
+
+		for _, child := range parseBoxes(data) {
+			if child.kind == kind {
+				data = child.data
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return nil
+		}
+	}
+
+	return data
+}
+
+// fullBoxEntries returns the entry count and entries of a full box
+func fullBoxEntries(data []byte, entrySize int) (int, []byte, error) {
+	if len(data) < 8 {
+		return 0, nil, fmt.Errorf("box too small")
+	}
+
+	count := int(binary.BigEndian.Uint32(data[4:8]))
+	entries := data[8:]
+
+	if count < 0 || len(entries) < count*entrySize {
+		return 0, nil, fmt.Errorf("box entries truncated")
+	}
+
+	return count, entries, nil
+}
+
+// parseMP4Keyframes maps the sync samples of the first video track to the
+// offsets of the chunks containing them
+func parseMP4Keyframes(moov []byte) ([]int64, error) {
+	for _, trak := range parseBoxes(findBox(moov, "moov")) {
+		if trak.kind != "trak" {
+			continue
+		}
+
+		stbl := findBox(trak.data, "mdia", "minf", "stbl")
+		if stbl == nil {
+			continue
+		}
+
+		stss := findBox(stbl, "stss")
+		if stss == nil {
+			continue // Every sample is a sync sample, not a video track
+		}
+
+		return parseSampleTable(stbl, stss)
+	}
+
+	return nil, fmt.Errorf("no track with sync samples")
+}
+
+func parseSampleTable(stbl []byte, stss []byte) ([]int64, error) {
+	syncCount, syncEntries, err := fullBoxEntries(stss, 4)
+	if err != nil {
+		return nil, err
+	}
+
+	stsc := findBox(stbl, "stsc")
+	if stsc == nil {
+		return nil, fmt.Errorf("stsc box not found")
+	}
+
+	stscCount, stscEntries, err := fullBoxEntries(stsc, 12)
+	if err != nil {
+		return nil, err
+	}
+
+	var chunkOffsets []int64
+
+	if stco := findBox(stbl, "stco"); stco != nil {
+		count, entries, err := fullBoxEntries(stco, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint32(entries[i*4:])))
+		}
+	} else if co64 := findBox(stbl, "co64"); co64 != nil {
+		count, entries, err := fullBoxEntries(co64, 8)
+		if err != nil {
+			return nil, err
+		}
+
+		for i := 0; i < count; i++ {
+			chunkOffsets = append(chunkOffsets, int64(binary.BigEndian.Uint64(entries[i*8:])))
+		}
+	} else {
+		return nil, fmt.Errorf("chunk offset box not found")
+	}
+
+	keyframes := make([]int64, 0, syncCount)
+
+	// Samples are numbered from 1, chunks as well
+	entry := 0
+	firstSample := int64(1)
+
+	for i := 0; i < syncCount; i++ {
+		sample := int64(binary.BigEndian.Uint32(syncEntries[i*4:]))
+
+		for entry < stscCount {
+			firstChunk := int64(binary.BigEndian.Uint32(stscEntries[entry*12:]))
+			samplesPerChunk := int64(binary.BigEndian.Uint32(stscEntries[entry*12+4:]))
+
+			lastChunk := int64(len(chunkOffsets))
+			if entry+1 < stscCount {
+				lastChunk = int64(binary.BigEndian.Uint32(stscEntries[(entry+1)*12:])) - 1
+			}
+
+			samples := (lastChunk - firstChunk + 1) * samplesPerChunk
+
+			if samplesPerChunk > 0 && sample < firstSample+samples {
+				chunk := firstChunk + (sample-firstSample)/samplesPerChunk
+				if chunk >= 1 && chunk <= int64(len(chunkOffsets)) {
+					keyframes = append(keyframes, chunkOffsets[chunk-1])
+				}
+
+				break
+			}
+
+			firstSample += max(samples, 0)
+			entry++
+		}
+	}
+
+	return keyframes, nil
+}
+
+func parseMatroskaKeyframes(cues []byte, base int64) ([]int64, error) {
+	header, err := parseElement(cues)
+	if err != nil {
+		return nil, err
+	}
+
+	if header.id != cuesId {
+		return nil, fmt.Errorf("index is not a cues element")
+	}
+
+	var keyframes []int64
+
+	walkElements(cues[header.headerSize:], func(id uint64, data []byte) {
+		if id != cuePointId {
+			return
+		}
+
+		walkElements(data, func(id uint64, data []byte) {
+			if id != cueTrackPositionsId {
+				return
+			}
+
+			walkElements(data, func(id uint64, data []byte) {
+				if id == cueClusterPositionId {
+					keyframes = append(keyframes, base+int64(parseUint(data)))
+				}
+			})
+		})
+	})
+
+	if len(keyframes) == 0 {
+		return nil, fmt.Errorf("no cue points found")
+	}
+
+	return keyframes, nil
+}
+
+func walkElements(data []byte, f func(id uint64, data []byte)) {
+	for position := 0; position < len(data); {
+		parsed, err := parseElement(data[position:])
+		if err != nil || parsed.size == unknownSize {
+			return
+		}
+
+		start := position + int(parsed.headerSize)
+		end := min(start+int(parsed.size), len(data))
+
+		f(parsed.id, data[start:end])
+
+		position = end
+	}
+}
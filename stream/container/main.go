@@ -0,0 +1,109 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+type Format int
+
+const (
+	Unknown Format = iota
+	MP4
+	Matroska
+)
+
+func (format Format) String() string {
+	switch format {
+	case MP4:
+		return "mp4"
+	case Matroska:
+		return "matroska"
+	default:
+		return "unknown"
+	}
+}
+
+type Range struct {
+	Offset int64
+	Length int64
+}
+
+// Info describes the container of a file and where its index is stored
+type Info struct {
+	Format    Format
+	Index     Range
+	Keyframes []int64
+
+	// Offset keyframe positions in the index are relative to
+	base int64
+}
+
+const sniffSize = 12
+
+var matroskaMagic = []byte{0x1A, 0x45, 0xDF, 0xA3}
+
+func Detect(head []byte) Format {
+	switch {
+	case len(head) >= 8 && string(head[4:8]) == "ftyp":
+		return MP4
+	case bytes.HasPrefix(head, matroskaMagic):
+		return Matroska
+	default:
+		return Unknown
+	}
+}
+
+// Probe detects the container of the file and locates its index, the reader
+// is only read at the few offsets needed to walk the top level structure
+func Probe(reader io.ReaderAt, size int64) (*Info, error) {
+	head := make([]byte, sniffSize)
+
+	n, err := reader.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	format := Detect(head[:n])
+
+	var index Range
+	var base int64
+
+	switch format {
+	case MP4:
+		index, err = findMP4Index(reader, size)
+	case Matroska:
+		index, base, err = findMatroskaIndex(reader, size)
+	default:
+		return nil, fmt.Errorf("unknown container")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Info{
+		Format: format,
+		Index:  index,
+
+		base: base,
+	}, nil
+}
+
+// readAt reads up to length bytes at offset, a short read at the end of the file is not an error
+func readAt(reader io.ReaderAt, offset int64, length int64, size int64) ([]byte, error) {
+	length = min(length, size-offset)
+	if length <= 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	buffer := make([]byte, length)
+
+	n, err := reader.ReadAt(buffer, offset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	return buffer[:n], nil
+}
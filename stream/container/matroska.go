@@ -0,0 +1,243 @@
+package container
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+const (
+	ebmlHeaderId       = 0x1A45DFA3
+	segmentId          = 0x18538067
+	seekHeadId         = 0x114D9B74
+	seekId             = 0x4DBB
+	seekIdId           = 0x53AB
+	seekPositionId     = 0x53AC
+	cuesId             = 0x1C53BB6B
+	clusterId          = 0x1F43B675
+	unknownSize        = -1
+	maxElementHeader   = 12
+	maxSeekHeadLength  = 64 * 1024
+	maxSegmentChildren = 16
+)
+
+type element struct {
+	id         uint64
+	size       int64
+	headerSize int64
+}
+
+// parseVint parses an EBML variable length integer, the length marker is kept
+// for element ids and removed for sizes
+func parseVint(data []byte, keepMarker bool) (uint64, int, error) {
+	if len(data) == 0 || data[0] == 0 {
+		return 0, 0, fmt.Errorf("invalid variable length integer")
+	}
+
+	length := 1
+	for mask := byte(0x80); data[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+
+	if len(data) < length {
+		return 0, 0, io.ErrUnexpectedEOF
+	}
+
+	value := uint64(data[0])
+	if !keepMarker {
+		value &= uint64(0xFF >> length)
+	}
+
+	for _, b := range data[1:length] {
+		value = value<<8 | uint64(b)
+	}
+
+	return value, length, nil
+}
+
+func parseElement(data []byte) (element, error) {
+	id, idLength, err := parseVint(data, true)
+	if err != nil {
+		return element{}, err
+	}
+
+	size, sizeLength, err := parseVint(data[idLength:], false)
+	if err != nil {
+		return element{}, err
+	}
+
+	parsed := element{
+		id:         id,
+		size:       int64(size),
+		headerSize: int64(idLength + sizeLength),
+	}
+
+	// All data bits set means the size is unknown
+	if size == 1<<(7*sizeLength)-1 {
+		parsed.size = unknownSize
+	}
+
+	return parsed, nil
+}
+
+func readElement(reader io.ReaderAt, offset int64, size int64) (element, error) {
+	data, err := readAt(reader, offset, maxElementHeader, size)
+	if err != nil {
+		return element{}, err
+	}
+
+	return parseElement(data)
+}
+
+func parseUint(data []byte) uint64 {
+	var value uint64
+	for _, b := range data {
+		value = value<<8 | uint64(b)
+	}
+
+	return value
+}
+
+func encodeId(id uint64) []byte {
+	var encoded []byte
+	for ; id > 0; id >>= 8 {
+		encoded = append([]byte{byte(id)}, encoded...)
+	}
+
+	return encoded
+}
+
+// findMatroskaIndex locates the Cues element through the SeekHead at the
+// start of the segment, the offset of the segment data is returned as well
+func findMatroskaIndex(reader io.ReaderAt, size int64) (Range, int64, error) {
+	header, err := readElement(reader, 0, size)
+	if err != nil {
+		return Range{}, 0, err
+	}
+
+	if header.id != ebmlHeaderId || header.size == unknownSize {
+		return Range{}, 0, fmt.Errorf("invalid EBML header")
+	}
+
+	segmentOffset := header.headerSize + header.size
+
+	segment, err := readElement(reader, segmentOffset, size)
+	if err != nil {
+		return Range{}, 0, err
+	}
+
+	if segment.id != segmentId {
+		return Range{}, 0, fmt.Errorf("segment not found")
+	}
+
+	segmentData := segmentOffset + segment.headerSize
+
+	offset := segmentData
+	for i := 0; i < maxSegmentChildren && offset < size; i++ {
+		child, err := readElement(reader, offset, size)
+		if err != nil {
+			return Range{}, 0, err
+		}
+
+		switch child.id {
+		case cuesId:
+			return elementRange(offset, child, size), segmentData, nil
+
+		case seekHeadId:
+			cuesPosition, err := findCuesPosition(reader, offset+child.headerSize, child.size, size)
+			if err != nil {
+				return Range{}, 0, err
+			}
+
+			if cuesPosition >= size-segmentData {
+				return Range{}, 0, fmt.Errorf("seek head points past the end of the file to %d", cuesPosition)
+			}
+
+			cues, err := readElement(reader, segmentData+cuesPosition, size)
+			if err != nil {
+				return Range{}, 0, err
+			}
+
+			if cues.id != cuesId {
+				return Range{}, 0, fmt.Errorf("seek head points to element %x instead of cues", cues.id)
+			}
+
+			return elementRange(segmentData+cuesPosition, cues, size), segmentData, nil
+
+		case clusterId:
+			return Range{}, 0, fmt.Errorf("cues not found before first cluster")
+		}
+
+		if child.size == unknownSize {
+			break
+		}
+
+		offset += child.headerSize + child.size
+	}
+
+	return Range{}, 0, fmt.Errorf("cues not found")
+}
+
+func findCuesPosition(reader io.ReaderAt, offset int64, length int64, size int64) (int64, error) {
+	if length == unknownSize || length > maxSeekHeadLength {
+		return 0, fmt.Errorf("invalid seek head size %d", length)
+	}
+
+	data, err := readAt(reader, offset, length, size)
+	if err != nil {
+		return 0, err
+	}
+
+	cues := encodeId(cuesId)
+
+	for position := 0; position < len(data); {
+		seek, err := parseElement(data[position:])
+		if err != nil || seek.size == unknownSize {
+			break
+		}
+
+		start := position + int(seek.headerSize)
+		end := min(start+int(seek.size), len(data))
+
+		if seek.id == seekId {
+			var id []byte
+			var seekPosition int64 = -1
+
+			for child := start; child < end; {
+				entry, err := parseElement(data[child:end])
+				if err != nil || entry.size == unknownSize {
+					break
+				}
+
+				valueStart := child + int(entry.headerSize)
+				valueEnd := min(valueStart+int(entry.size), end)
+
+				switch entry.id {
+				case seekIdId:
+					id = data[valueStart:valueEnd]
+				case seekPositionId:
+					seekPosition = int64(parseUint(data[valueStart:valueEnd]))
+				}
+
+				child = valueEnd
+			}
+
+			if bytes.Equal(id, cues) && seekPosition >= 0 {
+				return seekPosition, nil
+			}
+		}
+
+		position = end
+	}
+
+	return 0, fmt.Errorf("cues not referenced in seek head")
+}
+
+func elementRange(offset int64, parsed element, size int64) Range {
+	length := parsed.headerSize + parsed.size
+	if parsed.size == unknownSize || offset+length > size {
+		length = size - offset
+	}
+
+	return Range{Offset: offset, Length: length}
+}
@@ -0,0 +1,271 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+// ebmlSize encodes the size with the longest length, 8 bytes
+func ebmlSize(size uint64) []byte {
+	encoded := binary.BigEndian.AppendUint64(nil, size)
+	encoded[0] = 0x01
+
+	return encoded
+}
+
+func ebmlElement(id uint64, payload ...[]byte) []byte {
+	data := slices.Concat(payload...)
+
+	return slices.Concat(encodeId(id), ebmlSize(uint64(len(data))), data)
+}
+
+func TestParseVint(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       []byte
+		keepMarker bool
+
+		value  uint64
+		length int
+		err    bool
+	}{
+		{name: "one byte", data: []byte{0x81}, value: 1, length: 1},
+		{name: "two bytes", data: []byte{0x40, 0x02}, value: 2, length: 2},
+		{name: "eight bytes", data: []byte{0x01, 0, 0, 0, 0, 0, 0x01, 0x00}, value: 256, length: 8},
+		{name: "id", data: []byte{0x1A, 0x45, 0xDF, 0xA3}, keepMarker: true, value: ebmlHeaderId, length: 4},
+		{name: "trailing data", data: []byte{0x82, 0xFF}, value: 2, length: 1},
+
+		{name: "empty", data: nil, err: true},
+		{name: "no length marker", data: []byte{0x00, 0x81}, err: true},
+		{name: "truncated", data: []byte{0x10, 0x00}, err: true},
+	}
+
+	for _, test := range tests {
+		value, length, err := parseVint(test.data, test.keepMarker)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %d", test.name, value)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		if value != test.value || length != test.length {
+			t.Errorf("%s: got %d with length %d, expected %d with length %d", test.name, value, length, test.value, test.length)
+		}
+	}
+
+	if _, _, err := parseVint([]byte{0x20, 0x00}, false); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected EOF for a truncated integer, got %v", err)
+	}
+}
+
+func TestParseElementSize(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		size int64
+	}{
+		{name: "one byte size", data: []byte{0xEC, 0x85}, size: 5},
+		{name: "unknown one byte size", data: []byte{0xEC, 0xFF}, size: unknownSize},
+		{name: "unknown eight byte size", data: []byte{0xEC, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}, size: unknownSize},
+		{name: "largest eight byte size", data: []byte{0xEC, 0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE}, size: 1<<56 - 2},
+	}
+
+	for _, test := range tests {
+		parsed, err := parseElement(test.data)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		if parsed.size != test.size || parsed.headerSize != int64(len(test.data)) {
+			t.Errorf("%s: got size %d with header %d", test.name, parsed.size, parsed.headerSize)
+		}
+	}
+
+	if _, err := parseElement([]byte{0x1A, 0x45, 0xDF}); err == nil {
+		t.Errorf("expected an error for a truncated id")
+	}
+
+	if _, err := parseElement([]byte{0xEC}); err == nil {
+		t.Errorf("expected an error for a missing size")
+	}
+}
+
+type matroskaFile struct {
+	data []byte
+
+	segmentData int64
+	cues        Range
+	cluster     int64
+}
+
+// newMatroska builds a file with a segment of unknown size holding a seek
+// head, a cluster and the cues pointing to the cluster
+func newMatroska(cuesSize []byte) matroskaFile {
+	ebml := ebmlElement(ebmlHeaderId, ebmlElement(0x4282, []byte("webm")))
+	segment := slices.Concat(encodeId(segmentId), []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+
+	seekHead := func(position uint64) []byte {
+		return ebmlElement(seekHeadId, ebmlElement(seekId,
+			ebmlElement(seekIdId, encodeId(cuesId)),
+			ebmlElement(seekPositionId, binary.BigEndian.AppendUint64(nil, position)),
+		))
+	}
+
+	clusterPosition := len(seekHead(0))
+	cluster := ebmlElement(clusterId, make([]byte, 1000))
+
+	cuesPayload := ebmlElement(cuePointId,
+		ebmlElement(0xB3, []byte{0}),
+		ebmlElement(cueTrackPositionsId,
+			ebmlElement(0xF7, []byte{1}),
+			ebmlElement(cueClusterPositionId, binary.BigEndian.AppendUint16(nil, uint16(clusterPosition))),
+		),
+	)
+
+	if cuesSize == nil {
+		cuesSize = ebmlSize(uint64(len(cuesPayload)))
+	}
+
+	cues := slices.Concat(encodeId(cuesId), cuesSize, cuesPayload)
+	cuesPosition := clusterPosition + len(cluster)
+
+	segmentData := int64(len(ebml) + len(segment))
+
+	return matroskaFile{
+		data: slices.Concat(ebml, segment, seekHead(uint64(cuesPosition)), cluster, cues),
+
+		segmentData: segmentData,
+		cues:        Range{Offset: segmentData + int64(cuesPosition), Length: int64(len(cues))},
+		cluster:     segmentData + int64(clusterPosition),
+	}
+}
+
+func TestProbeMatroska(t *testing.T) {
+	file := newMatroska(nil)
+
+	info, err := Probe(bytes.NewReader(file.data), int64(len(file.data)))
+	if err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+
+	if info.Format != Matroska {
+		t.Fatalf("detected %s", info.Format)
+	}
+
+	if info.Index != file.cues {
+		t.Fatalf("got index %+v, expected %+v", info.Index, file.cues)
+	}
+
+	if err := info.ParseKeyframes(file.data[info.Index.Offset:]); err != nil {
+		t.Fatalf("failed to parse keyframes: %v", err)
+	}
+
+	if !slices.Equal(info.Keyframes, []int64{file.cluster}) {
+		t.Fatalf("got keyframes %v, expected %d", info.Keyframes, file.cluster)
+	}
+}
+
+func TestProbeOversizedMatroska(t *testing.T) {
+	// Cues claiming to extend past the end of the file are cut at the end
+	file := newMatroska(ebmlSize(1 << 40))
+
+	info, err := Probe(bytes.NewReader(file.data), int64(len(file.data)))
+	if err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+
+	expected := Range{Offset: file.cues.Offset, Length: int64(len(file.data)) - file.cues.Offset}
+	if info.Index != expected {
+		t.Fatalf("got index %+v, expected %+v", info.Index, expected)
+	}
+
+	// Cues of unknown size extend to the end of the file as well
+	file = newMatroska([]byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF})
+
+	info, err = Probe(bytes.NewReader(file.data), int64(len(file.data)))
+	if err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+
+	if info.Index != expected {
+		t.Fatalf("got index %+v, expected %+v", info.Index, expected)
+	}
+}
+
+func TestProbeInvalidMatroska(t *testing.T) {
+	file := newMatroska(nil)
+
+	withSeekPosition := func(position uint64) []byte {
+		data := slices.Clone(file.data)
+
+		// The seek position is the last 8 bytes of the seek head
+		offset := file.segmentData + int64(len(ebmlElement(seekHeadId, ebmlElement(seekId,
+			ebmlElement(seekIdId, encodeId(cuesId)),
+			ebmlElement(seekPositionId, make([]byte, 8)),
+		)))) - 8
+		binary.BigEndian.PutUint64(data[offset:], position)
+
+		return data
+	}
+
+	oversizedHeader := slices.Concat(encodeId(ebmlHeaderId), []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFE})
+
+	oversizedSeekHead := slices.Concat(
+		ebmlElement(ebmlHeaderId),
+		encodeId(segmentId), []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF},
+		encodeId(seekHeadId), ebmlSize(maxSeekHeadLength+1), make([]byte, 100),
+	)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{name: "truncated", data: file.data[:file.segmentData+4]},
+		{name: "unknown header size", data: slices.Concat(encodeId(ebmlHeaderId), []byte{0xFF}, make([]byte, 100))},
+		{name: "oversized header", data: slices.Concat(oversizedHeader, make([]byte, 100))},
+		{name: "oversized seek head", data: oversizedSeekHead},
+		{name: "seek position past the end", data: withSeekPosition(1 << 40)},
+		{name: "seek position overflowing", data: withSeekPosition(1<<63 - 1)},
+		{name: "seek position not at the cues", data: withSeekPosition(0)},
+		{name: "no segment", data: ebmlElement(ebmlHeaderId, make([]byte, 100))},
+	}
+
+	for _, test := range tests {
+		if info, err := Probe(bytes.NewReader(test.data), int64(len(test.data))); err == nil {
+			t.Errorf("%s: expected an error, got %+v", test.name, info)
+		}
+	}
+}
+
+func TestParseInvalidMatroskaKeyframes(t *testing.T) {
+	tests := []struct {
+		name  string
+		index []byte
+	}{
+		{name: "not cues", index: ebmlElement(clusterId, make([]byte, 10))},
+		{name: "no cue points", index: ebmlElement(cuesId, ebmlElement(0xEC, make([]byte, 10)))},
+		{name: "oversized cue point", index: slices.Concat(encodeId(cuesId), ebmlSize(20), encodeId(cuePointId), ebmlSize(1<<50), make([]byte, 3))},
+		{name: "truncated", index: ebmlElement(cuesId)[:3]},
+	}
+
+	for _, test := range tests {
+		info := &Info{Format: Matroska, Index: Range{Length: int64(len(test.index))}}
+
+		if err := info.ParseKeyframes(test.index); err == nil {
+			t.Errorf("%s: expected an error, got keyframes %v", test.name, info.Keyframes)
+		}
+	}
+}
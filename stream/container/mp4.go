@@ -0,0 +1,67 @@
+package container
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type boxHeader struct {
+	kind       string
+	size       int64
+	headerSize int64
+}
+
+func parseBoxHeader(data []byte, remaining int64) (boxHeader, error) {
+	if len(data) < 8 {
+		return boxHeader{}, io.ErrUnexpectedEOF
+	}
+
+	header := boxHeader{
+		kind:       string(data[4:8]),
+		size:       int64(binary.BigEndian.Uint32(data[0:4])),
+		headerSize: 8,
+	}
+
+	switch header.size {
+	case 0: // Box extends to the end of the file
+		header.size = remaining
+	case 1: // 64 bit size follows the type
+		if len(data) < 16 {
+			return boxHeader{}, io.ErrUnexpectedEOF
+		}
+
+		header.size = int64(binary.BigEndian.Uint64(data[8:16]))
+		header.headerSize = 16
+	}
+
+	if header.size < header.headerSize || header.size > remaining {
+		return boxHeader{}, fmt.Errorf("invalid size %d for box %q", header.size, header.kind)
+	}
+
+	return header, nil
+}
+
+// findMP4Index walks the top level boxes until the moov box is found, which
+// is often stored after the media data at the end of the file
+func findMP4Index(reader io.ReaderAt, size int64) (Range, error) {
+	for offset := int64(0); offset+8 <= size; {
+		data, err := readAt(reader, offset, 16, size)
+		if err != nil {
+			return Range{}, err
+		}
+
+		header, err := parseBoxHeader(data, size-offset)
+		if err != nil {
+			return Range{}, err
+		}
+
+		if header.kind == "moov" {
+			return Range{Offset: offset, Length: header.size}, nil
+		}
+
+		offset += header.size
+	}
+
+	return Range{}, fmt.Errorf("moov box not found")
+}
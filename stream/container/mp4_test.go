@@ -0,0 +1,213 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+)
+
+func mp4Box(kind string, payload ...[]byte) []byte {
+	data := slices.Concat(payload...)
+
+	box := binary.BigEndian.AppendUint32(nil, uint32(8+len(data)))
+	box = append(box, kind...)
+
+	return append(box, data...)
+}
+
+// fullBox builds a box with a version, flags and the count of its 4 byte entries
+func fullBox(kind string, entries ...uint32) []byte {
+	data := make([]byte, 4)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(entries)))
+
+	for _, entry := range entries {
+		data = binary.BigEndian.AppendUint32(data, entry)
+	}
+
+	return mp4Box(kind, data)
+}
+
+// sampleToChunk builds the stsc box, each entry holds the first chunk, the
+// samples per chunk and the sample description index
+func sampleToChunk(entries ...[3]uint32) []byte {
+	box := fullBox("stsc")
+	binary.BigEndian.PutUint32(box[12:], uint32(len(entries)))
+
+	for _, entry := range entries {
+		for _, value := range entry {
+			box = binary.BigEndian.AppendUint32(box, value)
+		}
+	}
+
+	binary.BigEndian.PutUint32(box, uint32(len(box)))
+
+	return box
+}
+
+func TestParseBoxHeader(t *testing.T) {
+	size64 := func(size uint64) []byte {
+		data := binary.BigEndian.AppendUint32(nil, 1)
+		data = append(data, "mdat"...)
+
+		return binary.BigEndian.AppendUint64(data, size)
+	}
+
+	tests := []struct {
+		name      string
+		data      []byte
+		remaining int64
+
+		size       int64
+		headerSize int64
+		err        bool
+	}{
+		{name: "box", data: mp4Box("free", make([]byte, 8)), remaining: 100, size: 16, headerSize: 8},
+		{name: "box to the end of the file", data: []byte{0, 0, 0, 0, 'm', 'd', 'a', 't'}, remaining: 100, size: 100, headerSize: 8},
+		{name: "64 bit size", data: size64(1 << 33), remaining: 1 << 34, size: 1 << 33, headerSize: 16},
+
+		{name: "truncated header", data: []byte{0, 0, 0, 16, 'f', 'r'}, remaining: 100, err: true},
+		{name: "truncated 64 bit size", data: size64(32)[:12], remaining: 100, err: true},
+		{name: "size smaller than the header", data: []byte{0, 0, 0, 4, 'f', 'r', 'e', 'e'}, remaining: 100, err: true},
+		{name: "size larger than the file", data: mp4Box("free", make([]byte, 8)), remaining: 12, err: true},
+		{name: "64 bit size smaller than the header", data: size64(8), remaining: 100, err: true},
+		{name: "64 bit size larger than the file", data: size64(1 << 40), remaining: 1 << 20, err: true},
+		{name: "64 bit size overflowing", data: size64(1 << 63), remaining: 1 << 62, err: true},
+	}
+
+	for _, test := range tests {
+		header, err := parseBoxHeader(test.data, test.remaining)
+
+		if test.err {
+			if err == nil {
+				t.Errorf("%s: expected an error, got %+v", test.name, header)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", test.name, err)
+			continue
+		}
+
+		if header.size != test.size || header.headerSize != test.headerSize {
+			t.Errorf("%s: got size %d with header %d, expected %d with header %d", test.name, header.size, header.headerSize, test.size, test.headerSize)
+		}
+	}
+
+	if _, err := parseBoxHeader([]byte{0, 0, 0, 1, 'm', 'd', 'a', 't', 0}, 100); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected an unexpected EOF for a truncated 64 bit size, got %v", err)
+	}
+}
+
+func newMP4(moov []byte) []byte {
+	ftyp := mp4Box("ftyp", []byte("isom"), make([]byte, 4))
+	mdat := mp4Box("mdat", make([]byte, 1000))
+
+	return slices.Concat(ftyp, mdat, moov)
+}
+
+func newMoov(stss []byte, stsc []byte, stco []byte) []byte {
+	stbl := mp4Box("stbl", stss, stsc, stco)
+
+	video := mp4Box("trak", mp4Box("mdia", mp4Box("minf", stbl)))
+	audio := mp4Box("trak", mp4Box("mdia", mp4Box("minf", mp4Box("stbl", stsc, stco))))
+
+	return mp4Box("moov", mp4Box("mvhd", make([]byte, 100)), audio, video)
+}
+
+func TestProbeMP4(t *testing.T) {
+	moov := newMoov(
+		fullBox("stss", 1, 4, 7),
+		// Chunks from the first one hold 2 samples, from the third one 3 samples
+		sampleToChunk([3]uint32{1, 2, 1}, [3]uint32{3, 3, 1}),
+		fullBox("stco", 100, 200, 300, 400),
+	)
+	file := newMP4(moov)
+
+	info, err := Probe(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatalf("failed to probe: %v", err)
+	}
+
+	if info.Format != MP4 {
+		t.Fatalf("detected %s", info.Format)
+	}
+
+	expected := Range{Offset: int64(len(file) - len(moov)), Length: int64(len(moov))}
+	if info.Index != expected {
+		t.Fatalf("got index %+v, expected %+v", info.Index, expected)
+	}
+
+	if err := info.ParseKeyframes(file[info.Index.Offset:]); err != nil {
+		t.Fatalf("failed to parse keyframes: %v", err)
+	}
+
+	// Sample 1 is in chunk 1, sample 4 in chunk 2 and sample 7 in chunk 3
+	if !slices.Equal(info.Keyframes, []int64{100, 200, 300}) {
+		t.Fatalf("got keyframes %v", info.Keyframes)
+	}
+
+	if keyframe, ok := info.NearestKeyframe(250); !ok || keyframe != 200 {
+		t.Fatalf("got nearest keyframe %d, %t", keyframe, ok)
+	}
+
+	if _, ok := info.NearestKeyframe(50); ok {
+		t.Fatalf("found a keyframe before the first one")
+	}
+}
+
+func TestProbeTruncatedMP4(t *testing.T) {
+	moov := newMoov(fullBox("stss", 1), sampleToChunk([3]uint32{1, 1, 1}), fullBox("stco", 100))
+
+	tests := []struct {
+		name string
+		file []byte
+	}{
+		{name: "moov cut off", file: newMP4(moov)[:len(newMP4(moov))-10]},
+		{name: "header cut off", file: newMP4(moov[:6])},
+		{name: "no moov", file: newMP4(nil)},
+		{name: "empty box", file: newMP4([]byte{0, 0, 0, 4, 'm', 'o', 'o', 'v'})},
+	}
+
+	for _, test := range tests {
+		if info, err := Probe(bytes.NewReader(test.file), int64(len(test.file))); err == nil {
+			t.Errorf("%s: expected an error, got %+v", test.name, info)
+		}
+	}
+}
+
+func TestParseTruncatedMP4Keyframes(t *testing.T) {
+	truncate := func(box []byte, length int) []byte {
+		binary.BigEndian.PutUint32(box, uint32(length))
+		return box[:length]
+	}
+
+	tests := []struct {
+		name string
+		moov []byte
+	}{
+		{name: "sync samples cut off", moov: newMoov(truncate(fullBox("stss", 1, 4), 20), sampleToChunk([3]uint32{1, 1, 1}), fullBox("stco", 100))},
+		{name: "sample to chunk entry cut off", moov: newMoov(fullBox("stss", 1), truncate(sampleToChunk([3]uint32{1, 1, 1}), 24), fullBox("stco", 100))},
+		{name: "chunk offsets cut off", moov: newMoov(fullBox("stss", 1), sampleToChunk([3]uint32{1, 1, 1}), truncate(fullBox("stco", 100, 200), 16))},
+		{name: "full box header cut off", moov: newMoov(truncate(fullBox("stss"), 12), sampleToChunk([3]uint32{1, 1, 1}), fullBox("stco", 100))},
+		{name: "no chunk offsets", moov: newMoov(fullBox("stss", 1), sampleToChunk([3]uint32{1, 1, 1}), nil)},
+		{name: "no sync samples", moov: newMoov(nil, sampleToChunk([3]uint32{1, 1, 1}), fullBox("stco", 100))},
+	}
+
+	for _, test := range tests {
+		info := &Info{Format: MP4, Index: Range{Length: int64(len(test.moov))}}
+
+		if err := info.ParseKeyframes(test.moov); err == nil {
+			t.Errorf("%s: expected an error, got keyframes %v", test.name, info.Keyframes)
+		}
+	}
+
+	info := &Info{Format: MP4, Index: Range{Length: 100}}
+	if err := info.ParseKeyframes(make([]byte, 50)); err == nil {
+		t.Errorf("expected an error for an incomplete index")
+	}
+}
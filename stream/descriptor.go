@@ -0,0 +1,93 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"fuse_video_streamer/stream/connection"
+)
+
+// Descriptor describes where a stream can be downloaded from
+type Descriptor struct {
+	Sources []connection.Source
+
+	// Zero when it is unknown when the sources expire
+	ExpiresAt time.Time
+
+	Size int64
+	ETag string
+}
+
+// Resolver returns the descriptor of a stream, refresh skips any cached
+// descriptor because the previous one expired
+type Resolver func(ctx context.Context, refresh bool) (*Descriptor, error)
+
+func (descriptor *Descriptor) isExpired() bool {
+	return !descriptor.ExpiresAt.IsZero() && !descriptor.ExpiresAt.After(time.Now())
+}
+
+func (descriptor *Descriptor) hasSource(url string) bool {
+	return slices.ContainsFunc(descriptor.Sources, func(source connection.Source) bool {
+		return source.Url == url
+	})
+}
+
+// source returns the best source for a new connection
+func (stream *Stream) source() (connection.Source, error) {
+	sources, err := stream.sources()
+	if err != nil {
+		return connection.Source{}, err
+	}
+
+	return sources[0], nil
+}
+
+// sources returns the sources from best to worst, the descriptor is resolved
+// again first when its expiry has passed
+func (stream *Stream) sources() ([]connection.Source, error) {
+	stream.resolveMu.Lock()
+	descriptor := stream.descriptor
+	stream.resolveMu.Unlock()
+
+	if descriptor.isExpired() {
+		_, err := stream.refreshSource(descriptor.Sources[0])
+		if err != nil {
+			return nil, err
+		}
+
+		stream.resolveMu.Lock()
+		descriptor = stream.descriptor
+		stream.resolveMu.Unlock()
+	}
+
+	return stream.mirrors.ranked(descriptor.Sources), nil
+}
+
+// refreshSource resolves a new descriptor after the given source expired,
+// connections that fail on the same descriptor at once share a single resolve
+func (stream *Stream) refreshSource(expired connection.Source) (connection.Source, error) {
+	stream.resolveMu.Lock()
+	defer stream.resolveMu.Unlock()
+
+	if !stream.descriptor.hasSource(expired.Url) {
+		return stream.mirrors.ranked(stream.descriptor.Sources)[0], nil
+	}
+
+	descriptor, err := stream.resolve(stream.ctx, true)
+	if err != nil {
+		return connection.Source{}, err
+	}
+
+	if len(descriptor.Sources) == 0 {
+		return connection.Source{}, fmt.Errorf("Descriptor of %s has no sources", stream.key)
+	}
+
+	stream.descriptor = descriptor
+	stream.mirrors.reset()
+
+	stream.logger.Info(fmt.Sprintf("Resolved a new descriptor for %s after it expired", stream.key))
+
+	return stream.mirrors.ranked(descriptor.Sources)[0], nil
+}
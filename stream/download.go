@@ -0,0 +1,496 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"fuse_video_streamer/stream/connection"
+	"fuse_video_streamer/stream/transfer"
+)
+
+const (
+	DefaultSegmentSize = int64(8 * 1024 * 1024) // 8MB
+
+	adjustInterval = 5 * time.Second
+)
+
+// download fetches the stream from a start position for a reader. The
+// look-ahead window is split in bounded segments that end on segment size
+// boundaries, every connection requests the next segment once it is done with
+// its current one and the reader is close enough.
+type download struct {
+	stream *Stream
+
+	next         int64
+	endPosition  int64
+	readPosition atomic.Int64
+
+	// Probes fetch a single small range over one connection
+	probe bool
+
+	maxConnections int64
+	connections    atomic.Int64
+	segmentSize    int64
+
+	segments map[*writer]struct{}
+
+	received atomic.Int64
+	stalled  atomic.Bool
+
+	hedged atomic.Bool
+
+	// Reads that wait for the download, a retired download is closed once
+	// the last of them is done
+	waiters int64
+	retired bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// First error the download failed with
+	err error
+
+	wg sync.WaitGroup
+	mu sync.Mutex
+
+	failed atomic.Bool
+	closed atomic.Bool
+}
+
+// newDownload fetches from the start position up to the end of the stream
+func newDownload(stream *Stream, startPosition int64) *download {
+	return startDownload(stream, startPosition, stream.size, false)
+}
+
+// newProbe fetches the range as a single request, used for the small reads
+// of media scanners before a stream is known to be played
+func newProbe(stream *Stream, startPosition int64, endPosition int64) *download {
+	return startDownload(stream, startPosition, endPosition, true)
+}
+
+func startDownload(stream *Stream, startPosition int64, endPosition int64, probe bool) *download {
+	ctx, cancel := context.WithCancel(stream.ctx)
+
+	maxConnections := int64(max(stream.options.Connections, 1))
+	if probe {
+		maxConnections = 1
+	}
+
+	segmentSize := stream.options.SegmentSize
+	if segmentSize <= 0 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	// Segments consist of whole chunks
+	segmentSize = stream.alignChunk(segmentSize)
+
+	download := &download{
+		stream: stream,
+
+		next:        startPosition,
+		endPosition: endPosition,
+		probe:       probe,
+
+		maxConnections: maxConnections,
+		segmentSize:    segmentSize,
+
+		segments: make(map[*writer]struct{}),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	download.readPosition.Store(startPosition)
+	download.connections.Store(maxConnections)
+
+	for worker := int64(0); worker < maxConnections; worker++ {
+		download.wg.Add(1)
+		go download.work(worker)
+	}
+
+	if maxConnections > 1 {
+		go download.adjust()
+	}
+
+	go func() {
+		download.wg.Wait()
+		download.end()
+	}()
+
+	return download
+}
+
+// setReadPosition moves the position the download looks ahead of
+func (download *download) setReadPosition(position int64) {
+	download.readPosition.Store(position)
+	download.stream.broadcast()
+}
+
+// follow moves the read position when the read belongs to the download, a
+// concurrent read of another region must not hold back its writers
+func (download *download) follow(position int64) {
+	download.mu.Lock()
+	fetched := download.readPosition.Load() <= position && position < download.next
+	download.mu.Unlock()
+
+	if fetched || download.covers(position) {
+		download.setReadPosition(position)
+	}
+}
+
+// covers reports whether the position will be downloaded soon
+func (download *download) covers(position int64) bool {
+	if download.isClosed() {
+		return false
+	}
+
+	preloadSize := calculatePreloadSize(calculateBufferSize(download.stream.size))
+
+	download.mu.Lock()
+	defer download.mu.Unlock()
+
+	for writer := range download.segments {
+		writerPosition := writer.Position()
+		if writerPosition <= position && position < writer.end && position-writerPosition < preloadSize {
+			return true
+		}
+	}
+
+	return download.next <= position && position < download.endPosition && position-download.next < preloadSize
+}
+
+func (download *download) Close() {
+	download.end()
+	download.wg.Wait()
+}
+
+// acquire registers a read that waits for the download
+func (download *download) acquire() bool {
+	download.mu.Lock()
+	defer download.mu.Unlock()
+
+	if download.isClosed() {
+		return false
+	}
+
+	download.waiters++
+
+	return true
+}
+
+func (download *download) release() {
+	download.mu.Lock()
+	download.waiters--
+	idle := download.retired && download.waiters <= 0
+	download.mu.Unlock()
+
+	if idle {
+		download.stream.removeDownload(download)
+		download.Close()
+	}
+}
+
+// isWaited reports whether a read currently waits for the download
+func (download *download) isWaited() bool {
+	download.mu.Lock()
+	defer download.mu.Unlock()
+
+	return download.waiters > 0 && !download.isClosed()
+}
+
+// retire is called when its reader moved on, the download is ended as soon
+// as no read waits for it anymore. Its workers finish in the background so
+// the reader is not held up by them.
+func (download *download) retire() {
+	download.mu.Lock()
+	download.retired = true
+	idle := download.waiters <= 0
+	download.mu.Unlock()
+
+	if idle {
+		download.stream.removeDownload(download)
+		download.end()
+	}
+}
+
+func (download *download) isClosed() bool {
+	return download.closed.Load()
+}
+
+func (download *download) isFailed() bool {
+	return download.failed.Load()
+}
+
+func (download *download) failure() error {
+	download.mu.Lock()
+	defer download.mu.Unlock()
+
+	return download.err
+}
+
+func (download *download) end() {
+	if !download.closed.CompareAndSwap(false, true) {
+		return
+	}
+
+	download.cancel()
+	download.stream.broadcast()
+}
+
+func (download *download) fail(err error) {
+	if download.isClosed() {
+		return
+	}
+
+	download.mu.Lock()
+	if download.err == nil {
+		download.err = err
+	}
+	download.mu.Unlock()
+
+	download.failed.Store(true)
+	download.stream.logger.Error(fmt.Sprintf("Download of %s failed", download.stream.key), err)
+
+	download.end()
+}
+
+func (download *download) work(worker int64) {
+	defer download.wg.Done()
+
+	for {
+		start, end, ok := download.claim(worker)
+		if !ok {
+			return
+		}
+
+		err := download.fetchSegment(start, end)
+		if err != nil {
+			download.fail(err)
+			return
+		}
+	}
+}
+
+// claim hands out the next segment within the look-ahead window, workers
+// above the current connection target wait until the target is raised
+func (download *download) claim(worker int64) (int64, int64, bool) {
+	stream := download.stream
+	lookahead := stream.lookahead()
+
+	for {
+		notify := stream.getNotify()
+
+		if download.isClosed() {
+			return 0, 0, false
+		}
+
+		download.mu.Lock()
+
+		download.skipCached()
+
+		start := download.next
+		if start >= download.endPosition {
+			download.mu.Unlock()
+			return 0, 0, false
+		}
+
+		if worker < download.connections.Load() && start < download.readPosition.Load()+lookahead {
+			// Aligned ranges are more likely to be cached by the CDN edge
+			end := min((start/download.segmentSize+1)*download.segmentSize, download.endPosition)
+			if download.probe {
+				end = download.endPosition
+			}
+
+			download.next = end
+			download.mu.Unlock()
+
+			return start, end, true
+		}
+
+		download.mu.Unlock()
+
+		if worker == 0 {
+			download.stalled.Store(true)
+		}
+
+		select {
+		case <-notify:
+		case <-download.ctx.Done():
+		}
+	}
+}
+
+// skipCached moves the next segment past the chunks that are already cached
+func (download *download) skipCached() {
+	stream := download.stream
+	chunkSize := stream.cache.ChunkSize()
+
+	for download.next < download.endPosition {
+		index := download.next / chunkSize
+
+		chunk := stream.cache.Get(stream.chunkKey(index))
+		if chunk == nil {
+			return
+		}
+
+		if !chunk.IsComplete() {
+			download.next = max(download.next, index*chunkSize+chunk.Filled())
+			return
+		}
+
+		download.next = (index + 1) * chunkSize
+	}
+}
+
+func (download *download) fetchSegment(start int64, end int64) error {
+	stream := download.stream
+
+	connection_, err := download.connect(start, end)
+	if err != nil {
+		return err
+	}
+
+	writer := newWriter(download, start, end)
+
+	download.mu.Lock()
+	download.segments[writer] = struct{}{}
+	download.mu.Unlock()
+
+	transfer := transfer.NewTransfer(writer, connection_, stream.mirrors, stream.bandwidth)
+
+	select {
+	case <-writer.done:
+	case <-download.ctx.Done():
+	}
+
+	transfer.Close()
+	writer.Close()
+
+	download.mu.Lock()
+	delete(download.segments, writer)
+	download.mu.Unlock()
+
+	if download.isClosed() {
+		return nil
+	}
+
+	if writer.Position() < end {
+		if err := transfer.Err(); err != nil {
+			return fmt.Errorf("segment %d-%d ended at %d: %w", start, end, writer.Position(), err)
+		}
+
+		return fmt.Errorf("segment %d-%d ended at %d", start, end, writer.Position())
+	}
+
+	return nil
+}
+
+// connect opens a connection for the segment on the best source, the first
+// segment of a hedged download races the two best sources
+func (download *download) connect(start int64, end int64) (*connection.Connection, error) {
+	stream := download.stream
+
+	sources, err := stream.sources()
+	if err != nil {
+		return nil, err
+	}
+
+	if !stream.options.Hedge || len(sources) < 2 || !download.hedged.CompareAndSwap(false, true) {
+		return download.newConnection(sources[0], start, end)
+	}
+
+	connections := make([]*connection.Connection, 0, 2)
+
+	for _, source := range sources[:2] {
+		connection_, err := download.newConnection(source, start, end)
+		if err != nil {
+			return nil, err
+		}
+
+		connections = append(connections, connection_)
+	}
+
+	winner, err := connection.Race(connections)
+	if err != nil {
+		// Neither source responded, the transfer retries and fails over
+		return download.newConnection(sources[0], start, end)
+	}
+
+	for _, source := range sources[:2] {
+		if source.Url != winner.Source().Url {
+			stream.mirrors.penalize(source.Url)
+		}
+	}
+
+	return winner, nil
+}
+
+func (download *download) newConnection(source connection.Source, start int64, end int64) (*connection.Connection, error) {
+	connection_, err := connection.NewRangeConnection(source, start, end-1)
+	if err != nil {
+		return nil, err
+	}
+
+	connection_.SetVerifier(download.stream.verify)
+
+	return connection_, nil
+}
+
+// adjust tunes the amount of connections towards the highest throughput
+func (download *download) adjust() {
+	ticker := time.NewTicker(adjustInterval)
+	defer ticker.Stop()
+
+	climber := climber{direction: -1}
+
+	for {
+		select {
+		case <-download.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		received := download.received.Swap(0)
+		stalled := download.stalled.Swap(false)
+
+		// Throughput is limited by the reader, not by the connections
+		if stalled {
+			continue
+		}
+
+		throughput := float64(received) / adjustInterval.Seconds()
+
+		connections, changed := climber.step(throughput, download.connections.Load(), download.maxConnections)
+		if !changed {
+			continue
+		}
+
+		download.connections.Store(connections)
+		download.stream.broadcast()
+	}
+}
+
+// climber steps the amount of connections up or down and reverses once the
+// throughput drops, it holds while the throughput stays within 10%
+type climber struct {
+	lastThroughput float64
+	direction      int64
+}
+
+func (climber *climber) step(throughput float64, connections int64, maxConnections int64) (int64, bool) {
+	switch {
+	case throughput > climber.lastThroughput*1.1:
+	case throughput < climber.lastThroughput*0.9:
+		climber.direction = -climber.direction
+	default:
+		climber.lastThroughput = throughput
+		return connections, false
+	}
+
+	climber.lastThroughput = throughput
+
+	return min(max(connections+climber.direction, 1), maxConnections), true
+}
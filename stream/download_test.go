@@ -0,0 +1,193 @@
+package stream
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/stream/cache"
+)
+
+// newStream returns a stream whose only source is never connected to
+func newStream(t *testing.T, size int64, options Options) *Stream {
+	stream, err := New(context.Background(), streamKey(t), size, options, resolveTo("http://127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { stream.Close() })
+
+	return stream
+}
+
+// idleDownload returns a download of the range without workers, so the
+// tests can claim its segments themselves
+func idleDownload(stream *Stream, start int64, end int64, connections int64, segmentSize int64) *download {
+	ctx, cancel := context.WithCancel(stream.ctx)
+
+	download := &download{
+		stream: stream,
+
+		next:        start,
+		endPosition: end,
+
+		maxConnections: connections,
+		segmentSize:    segmentSize,
+
+		segments: make(map[*writer]struct{}),
+
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	download.readPosition.Store(start)
+	download.connections.Store(connections)
+
+	return download
+}
+
+func expectClaim(t *testing.T, download *download, worker int64, start int64, end int64) {
+	t.Helper()
+
+	claimedStart, claimedEnd, ok := download.claim(worker)
+	if !ok || claimedStart != start || claimedEnd != end {
+		t.Fatalf("worker %d claimed %d-%d (%t), expected %d-%d", worker, claimedStart, claimedEnd, ok, start, end)
+	}
+}
+
+func TestClaimHandsOutAlignedSegments(t *testing.T) {
+	stream := newStream(t, 64*1024*1024, Options{})
+	chunkSize := stream.cache.ChunkSize()
+
+	// The download starts within the first segment, which is cut at its boundary
+	download := idleDownload(stream, chunkSize, 5*chunkSize, 2, 2*chunkSize)
+
+	expectClaim(t, download, 0, chunkSize, 2*chunkSize)
+	expectClaim(t, download, 1, 2*chunkSize, 4*chunkSize)
+	expectClaim(t, download, 0, 4*chunkSize, 5*chunkSize)
+
+	if _, _, ok := download.claim(1); ok {
+		t.Fatalf("a segment was claimed past the end of the download")
+	}
+}
+
+func TestClaimSkipsCachedChunks(t *testing.T) {
+	stream := newStream(t, 64*1024*1024, Options{})
+	chunkSize := stream.cache.ChunkSize()
+
+	stream.cache.Put(stream.chunkKey(0), cache.NewCompleteChunk(make([]byte, chunkSize)))
+	stream.cache.Put(stream.chunkKey(1), cache.NewCompleteChunk(make([]byte, chunkSize)))
+
+	partial := cache.NewChunk(chunkSize)
+	partial.WriteAt(make([]byte, 1000), 0)
+	stream.cache.Put(stream.chunkKey(2), partial)
+
+	download := idleDownload(stream, 0, 8*chunkSize, 1, 4*chunkSize)
+
+	// The filled part of the partial chunk is not fetched again
+	expectClaim(t, download, 0, 2*chunkSize+1000, 4*chunkSize)
+
+	stream.cache.Put(stream.chunkKey(4), cache.NewCompleteChunk(make([]byte, chunkSize)))
+
+	expectClaim(t, download, 0, 5*chunkSize, 8*chunkSize)
+}
+
+func TestClaimWaitsForConnectionTarget(t *testing.T) {
+	stream := newStream(t, 64*1024*1024, Options{})
+	chunkSize := stream.cache.ChunkSize()
+
+	download := idleDownload(stream, 0, 8*chunkSize, 2, chunkSize)
+	download.connections.Store(1)
+
+	claimed := make(chan bool)
+	go func() {
+		_, _, ok := download.claim(1)
+		claimed <- ok
+	}()
+
+	select {
+	case <-claimed:
+		t.Fatalf("a worker above the connection target claimed a segment")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	download.connections.Store(2)
+	stream.broadcast()
+
+	select {
+	case ok := <-claimed:
+		if !ok {
+			t.Fatalf("the worker did not claim a segment once the target was raised")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the worker kept waiting once the target was raised")
+	}
+
+	download.connections.Store(1)
+
+	go func() {
+		_, _, ok := download.claim(1)
+		claimed <- ok
+	}()
+
+	download.end()
+
+	select {
+	case ok := <-claimed:
+		if ok {
+			t.Fatalf("a segment was claimed from an ended download")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("the worker kept waiting after the download ended")
+	}
+}
+
+func TestClaimProbeFetchesWholeRange(t *testing.T) {
+	stream := newStream(t, 64*1024*1024, Options{})
+	chunkSize := stream.cache.ChunkSize()
+
+	download := idleDownload(stream, 100, 3*chunkSize, 1, chunkSize)
+	download.probe = true
+
+	expectClaim(t, download, 0, 100, 3*chunkSize)
+}
+
+func TestClimberFollowsThroughput(t *testing.T) {
+	hill := climber{direction: -1}
+
+	steps := []struct {
+		throughput  float64
+		connections int64
+		changed     bool
+	}{
+		// Fewer connections are tried first and kept while it gets faster
+		{throughput: 100, connections: 7, changed: true},
+		{throughput: 120, connections: 6, changed: true},
+
+		// Within 10% the amount is held
+		{throughput: 125, connections: 6, changed: false},
+
+		// A drop reverses the direction
+		{throughput: 80, connections: 7, changed: true},
+		{throughput: 100, connections: 8, changed: true},
+
+		// The amount stays within its bounds
+		{throughput: 200, connections: 8, changed: true},
+	}
+
+	connections := int64(8)
+
+	for i, step := range steps {
+		next, changed := hill.step(step.throughput, connections, 8)
+		if next != step.connections || changed != step.changed {
+			t.Fatalf("step %d at %.0f went to %d connections (%t), expected %d (%t)", i, step.throughput, next, changed, step.connections, step.changed)
+		}
+
+		connections = next
+	}
+
+	hill = climber{direction: -1, lastThroughput: 100}
+
+	if next, _ := hill.step(200, 1, 8); next != 1 {
+		t.Fatalf("stepped below a single connection to %d", next)
+	}
+}
@@ -0,0 +1,71 @@
+package factory
+
+import (
+	"sync"
+	"time"
+
+	"fuse_video_streamer/stream"
+)
+
+const DescriptorTTL = 15 * time.Minute
+
+type descriptorItem struct {
+	descriptor *stream.Descriptor
+	expiration time.Time
+}
+
+// descriptorCache keeps the resolved stream descriptor of every node until it
+// expires or is invalidated because its urls stopped working
+type descriptorCache struct {
+	items map[uint64]descriptorItem
+
+	mu sync.Mutex
+}
+
+func newDescriptorCache() *descriptorCache {
+	return &descriptorCache{
+		items: make(map[uint64]descriptorItem),
+	}
+}
+
+func (cache *descriptorCache) get(identifier uint64) (*stream.Descriptor, bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	item, ok := cache.items[identifier]
+	if !ok || !item.expiration.After(time.Now()) {
+		return nil, false
+	}
+
+	return item.descriptor, true
+}
+
+func (cache *descriptorCache) set(identifier uint64, descriptor *stream.Descriptor) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+
+	for key, item := range cache.items {
+		if !item.expiration.After(now) {
+			delete(cache.items, key)
+		}
+	}
+
+	expiration := now.Add(DescriptorTTL)
+	if !descriptor.ExpiresAt.IsZero() && descriptor.ExpiresAt.Before(expiration) {
+		expiration = descriptor.ExpiresAt
+	}
+
+	cache.items[identifier] = descriptorItem{
+		descriptor: descriptor,
+		expiration: expiration,
+	}
+}
+
+func (cache *descriptorCache) invalidate(identifier uint64) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.items, identifier)
+}
@@ -1,64 +1,102 @@
 package factory
 
 import (
+	"context"
 	"fmt"
 	"sync/atomic"
 	"time"
 
+	"fuse_video_streamer/config"
 	filesystem_client_interfaces "fuse_video_streamer/filesystem/client/interfaces"
 	"fuse_video_streamer/stream"
+	"fuse_video_streamer/stream/cache"
+	"fuse_video_streamer/stream/connection"
 )
 
-type CacheItem struct {
-	url string
-	expiration time.Time
-}
-
 type Factory struct {
 	client filesystem_client_interfaces.Client
 
-	cachedItem CacheItem
+	descriptors *descriptorCache
 
 	closed atomic.Bool
 }
 
 func New(client filesystem_client_interfaces.Client) *Factory {
 	return &Factory{
-		client:  client,
+		client:      client,
+		descriptors: newDescriptorCache(),
 	}
 }
 
-func (factory *Factory) NewStream(nodeIdentifier uint64, size uint64) (*stream.Stream, error) {
+// NewReader opens a reader on the stream of the node, handles of the same
+// node share a single stream
+func (factory *Factory) NewReader(ctx context.Context, nodeIdentifier uint64, size uint64) (*stream.Reader, error) {
 	if factory.isClosed() {
 		return nil, fmt.Errorf("Factory is closed")
 	}
 
-	url, err := factory.getStreamUrl(nodeIdentifier)
-	if err != nil {
-		return nil, err
+	key := cache.StreamKey(factory.client.GetName(), nodeIdentifier, int64(size))
+
+	return stream.Open(ctx, key, int64(size), factory.streamOptions(), func(ctx context.Context, refresh bool) (*stream.Descriptor, error) {
+		if refresh {
+			factory.descriptors.invalidate(nodeIdentifier)
+		}
+
+		return factory.getDescriptor(ctx, nodeIdentifier)
+	})
+}
+
+func (factory *Factory) streamOptions() stream.Options {
+	fileServer, _ := config.GetFileServer(factory.client.GetName())
+
+	suspendAfter := stream.DefaultSuspendAfter
+	if seconds := config.GetCache().SuspendAfterSeconds; seconds != 0 {
+		suspendAfter = max(time.Duration(seconds)*time.Second, 0)
 	}
 
-	return stream.New(url, int64(size))
+	return stream.Options{
+		Provider:     factory.client.GetName(),
+		Connections:  fileServer.Connections,
+		SegmentSize:  fileServer.SegmentSizeMB * 1024 * 1024,
+		Hedge:        fileServer.HedgedRequests,
+		SuspendAfter: suspendAfter,
+	}
 }
 
-func (factory *Factory) getStreamUrl(identifier uint64) (string, error) {
-	if factory.cachedItem.url != "" && factory.cachedItem.expiration.After(time.Now()) {
-		return factory.cachedItem.url, nil
+func (factory *Factory) getDescriptor(ctx context.Context, identifier uint64) (*stream.Descriptor, error) {
+	if descriptor, ok := factory.descriptors.get(identifier); ok {
+		return descriptor, nil
 	}
 
 	fileSystem := factory.client.GetFileSystem()
 
-	url, err := fileSystem.GetStreamUrl(identifier)
+	streamDescriptor, err := fileSystem.GetStreamDescriptor(ctx, identifier)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to get video url for node with id %d. %w", identifier, err)
+	}
+
+	descriptor := &stream.Descriptor{
+		ExpiresAt: streamDescriptor.ExpiresAt,
+		Size:      streamDescriptor.Size,
+		ETag:      streamDescriptor.ETag,
+	}
+
+	client, err := connection.GetClient(factory.client.GetName())
 	if err != nil {
-		return "", fmt.Errorf("Failed to get video url for node with id %d. %v", identifier, err.Error())
+		return nil, err
 	}
 
-	factory.cachedItem = CacheItem{
-		url: url,
-		expiration: time.Now().Add(15 * time.Minute),
+	for _, source := range streamDescriptor.Sources {
+		descriptor.Sources = append(descriptor.Sources, connection.Source{
+			Url:     source.Url,
+			Headers: source.Headers,
+			Client:  client,
+		})
 	}
 
-	return url, nil
+	factory.descriptors.set(identifier, descriptor)
+
+	return descriptor, nil
 }
 
 func (factory *Factory) Close() {
@@ -3,13 +3,15 @@ package stream
 import (
 	"context"
 	"fmt"
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream/bandwidth"
+	"fuse_video_streamer/stream/cache"
 	"fuse_video_streamer/stream/connection"
-	"fuse_video_streamer/stream/transfer"
+	"fuse_video_streamer/stream/container"
+	"fuse_video_streamer/stream/memory"
 	"sync"
 	"sync/atomic"
 	"time"
-
-	ring_buffer "github.com/sushydev/ring_buffer_go"
 )
 
 const (
@@ -26,23 +28,78 @@ const (
 	MaxPreloadSize         = int64(16 * 1024 * 1024)  // 16MB absolute max preload size
 )
 
+// Options tune how a stream is downloaded
+type Options struct {
+	// Name of the provider, streams of a provider share its bandwidth limit
+	Provider string
+
+	// Maximum amount of concurrent range connections
+	Connections int
+
+	// Size of the ranges that are fetched by the connections
+	SegmentSize int64
+
+	// Race the two best sources when a download starts and keep the fastest
+	Hedge bool
+
+	// Streams that are not read for this long close their connections, zero disables it
+	SuspendAfter time.Duration
+}
+
+// Stream holds the state of a remote file that is shared by every reader of it
 type Stream struct {
 	id   string
-	url  string
+	key  string
 	size int64
 
-	buffer ring_buffer.LockingRingBufferInterface
+	// Name the chunks are cached under, the key and its generation
+	chunks string
+
+	descriptor *Descriptor
+	resolve    Resolver
+	resolveMu  sync.Mutex
+	mirrors    *mirrors
+
+	bandwidth *bandwidth.Share
+	memory    *memory.Allocation
+
+	identities   map[string]connection.Identity
+	identitiesMu sync.Mutex
+	changed      atomic.Pointer[connection.ChangedError]
+
+	options Options
+
+	cache *cache.Cache
 
 	ctx    context.Context
 	cancel context.CancelFunc
 
-	transfer *transfer.Transfer
+	references int
+	downloads  map[*download]struct{}
+
+	// Suspended streams keep their metadata but no connections
+	lastRead  atomic.Int64
+	reading   atomic.Int64
+	suspended atomic.Bool
+
+	// Streams start in probe mode and stream once a reader reads sequentially
+	streaming atomic.Bool
+
+	container  atomic.Pointer[container.Info]
+	prediction prediction
+
+	logger *logger.Logger
+
+	notify   chan struct{}
+	notifyMu sync.Mutex
 
 	mu sync.Mutex
 
 	closed atomic.Bool
 }
 
+var streams Map
+
 func calculateBufferSize(fileSize int64) int64 {
 	return min(fileSize, SmallVideoBuffer)
 
@@ -73,27 +130,106 @@ func calculatePreloadSize(bufferSize int64) int64 {
 	}
 }
 
-func New(url string, size int64) (*Stream, error) {
+// Open returns a new reader on the stream of the given key, the stream is
+// created in probe mode when no other reader currently has it open. The
+// context only bounds resolving the descriptor of a new stream.
+func Open(ctx context.Context, key string, size int64, options Options, resolve Resolver) (*Reader, error) {
+	for {
+		if existing, ok := streams.Load(key); ok {
+			reader, err := existing.NewReader()
+			if err == nil {
+				return reader, nil
+			}
+
+			streams.CompareAndDelete(key, existing)
+		}
+
+		stream, err := New(ctx, key, size, options, resolve)
+		if err != nil {
+			return nil, err
+		}
+
+		if _, loaded := streams.LoadOrStore(key, stream); loaded {
+			stream.Close()
+			continue
+		}
+
+		reader, err := stream.NewReader()
+		if err != nil {
+			continue
+		}
+
+		return reader, nil
+	}
+}
+
+func New(ctx context.Context, key string, size int64, options Options, resolve Resolver) (*Stream, error) {
 	id := fmt.Sprintf("%d", time.Now().UnixNano())
 
-	bufferSize := calculateBufferSize(int64(size))
+	descriptor, err := resolve(ctx, false)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(descriptor.Sources) == 0 {
+		return nil, fmt.Errorf("Descriptor of %s has no sources", key)
+	}
+
+	logger, err := logger.NewLogger("Stream")
+	if err != nil {
+		return nil, err
+	}
+
+	chunks := chunkStream(key)
 
-	buffer := ring_buffer.NewLockingRingBuffer(bufferSize, 0)
+	allocation, err := memory.GetInstance().NewAllocation(chunks)
+	if err != nil {
+		return nil, err
+	}
 
-	ctx, cancel := context.WithCancel(context.Background())
+	streamCtx, cancel := context.WithCancel(context.Background())
+
+	if descriptor.Size > 0 && descriptor.Size != size {
+		logger.Warn(fmt.Sprintf("Size of %s is %d but the provider describes %d", key, size, descriptor.Size))
+	}
 
 	stream := &Stream{
-		id: id,
+		id:  id,
+		key: key,
+
+		chunks: chunks,
 
 		size: size,
-		url:  url,
 
-		buffer: buffer,
+		descriptor: descriptor,
+		resolve:    resolve,
+
+		memory: allocation,
+
+		options: options,
+
+		cache: cache.GetInstance(),
 
-		ctx:    ctx,
+		ctx:    streamCtx,
 		cancel: cancel,
+
+		downloads: make(map[*download]struct{}),
+
+		identities: make(map[string]connection.Identity),
+
+		notify: make(chan struct{}),
+
+		logger: logger,
 	}
 
+	stream.mirrors = newMirrors(stream)
+
+	stream.bandwidth = bandwidth.GetInstance().NewShare(options.Provider)
+
+	stream.lastRead.Store(time.Now().UnixNano())
+
+	go stream.watchIdle()
+
 	return stream, nil
 }
 
@@ -101,101 +237,185 @@ func (stream *Stream) Id() string {
 	return stream.id
 }
 
-func (stream *Stream) ReadAt(p []byte, seekPosition int64) (int, error) {
-	stream.mu.Lock()
-	defer stream.mu.Unlock()
+func (stream *Stream) isStreaming() bool {
+	return stream.streaming.Load()
+}
 
-	if stream.isClosed() {
-		return 0, fmt.Errorf("stream is closed")
+// escalate leaves probe mode, reads are served by full downloads from now on
+// and the index of the container is prefetched
+func (stream *Stream) escalate() {
+	if !stream.streaming.CompareAndSwap(false, true) {
+		return
 	}
 
-	if stream.buffer == nil {
-		return 0, fmt.Errorf("Buffer is closed")
-	}
+	stream.logger.Info(fmt.Sprintf("Stream %s left probe mode", stream.key))
 
-	requestedBytes := int64(len(p))
+	go stream.prefetch()
+}
 
-	if !stream.buffer.IsPositionAvailable(seekPosition) {
-		err := stream.newTransfer(seekPosition)
-		if err != nil {
-			return 0, err
-		}
+// promote gives the stream playback priority once a player is reading it
+func (stream *Stream) promote() {
+	if stream.bandwidth.SetClass(bandwidth.Playback) {
+		stream.logger.Info(fmt.Sprintf("Stream %s is read by a player", stream.key))
 	}
+}
 
-	requestedPosition := min(seekPosition+requestedBytes, stream.size)
+// demote returns the stream to the background class once its player stopped
+// reading, readers promote it again when playback continues
+func (stream *Stream) demote() {
+	if stream.bandwidth.SetClass(bandwidth.Background) {
+		stream.logger.Info(fmt.Sprintf("Stream %s is no longer read by a player", stream.key))
+	}
+}
 
-	if !stream.buffer.IsPositionAvailable(requestedPosition) {
-		ctx, cancel := context.WithTimeout(stream.ctx, 10*time.Second)
-		defer cancel()
+func (stream *Stream) NewReader() (*Reader, error) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
 
-		ok := stream.buffer.WaitForPosition(ctx, requestedPosition)
-		if !ok && !stream.isClosed() {
-			return 0, fmt.Errorf("Timeout waiting for the buffer to fill")
-		}
+	if stream.isClosed() {
+		return nil, ErrClosed
 	}
 
-	return stream.buffer.ReadAt(p, seekPosition)
+	stream.references++
+
+	return newReader(stream), nil
+}
+
+// release closes the stream once the last reader is gone, it is closed
+// while the lock is held so a concurrent Open can not add a reader to it
+func (stream *Stream) release() {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.references--
+
+	if stream.references <= 0 {
+		stream.shutdown()
+	}
 }
 
 func (stream *Stream) Close() error {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.shutdown()
+
+	return nil
+}
+
+// shutdown closes the stream, the caller holds the lock
+func (stream *Stream) shutdown() {
 	if !stream.closed.CompareAndSwap(false, true) {
-		return nil // Already closed
+		return // Already closed
 	}
 
 	stream.cancel()
 
-	if stream.buffer != nil {
-		err := stream.buffer.Close()
-		if err != nil {
-			return fmt.Errorf("Error closing buffer: %v", err)
-		}
+	streams.CompareAndDelete(stream.key, stream)
+	bandwidth.GetInstance().ReleaseShare(stream.bandwidth)
+	memory.GetInstance().Release(stream.memory)
 
-		stream.buffer = nil
+	// Writers that were still running may have stored chunks of the changed
+	// file, they belong to the old generation so the next stream keeps its own
+	if stream.isChanged() {
+		stream.cache.Remove(stream.chunks)
 	}
 
-	if stream.transfer != nil {
-		err := stream.transfer.Close()
-		if err != nil {
-			fmt.Println("Error closing transfer:", err)
-		}
+	stream.broadcast()
 
-		stream.transfer = nil
+	if stats := stream.Stats(); stats.Predicted > 0 {
+		message := fmt.Sprintf("Closed %s, %s index with %d keyframes, %d of %d predicted prefetches hit", stream.key, stats.Container, stats.Keyframes, stats.PredictionHits, stats.Predicted)
+		stream.logger.Info(message)
 	}
-
-	return nil
 }
 
 func (stream *Stream) isClosed() bool {
 	return stream.closed.Load()
 }
 
-func (stream *Stream) newTransfer(startPosition int64) error {
-	if stream.isClosed() {
-		return fmt.Errorf("Stream is closed")
+func (stream *Stream) chunkKey(index int64) cache.Key {
+	return cache.Key{
+		Stream: stream.chunks,
+		Index:  index,
 	}
+}
 
-	if stream.buffer == nil {
-		return fmt.Errorf("Buffer is closed")
-	}
+func (stream *Stream) readCached(p []byte, position int64) int {
+	chunkSize := stream.cache.ChunkSize()
+	index := position / chunkSize
 
-	if stream.transfer != nil {
-		stream.transfer.Close()
-		stream.transfer = nil
+	chunk := stream.cache.Get(stream.chunkKey(index))
+	if chunk == nil {
+		return 0
 	}
 
-	bufferSize := calculateBufferSize(stream.size)
-	preloadSize := calculatePreloadSize(bufferSize)
+	return chunk.ReadAt(p, position-index*chunkSize)
+}
 
-	streamStartPosition := max(0, startPosition-preloadSize)
+func (stream *Stream) isAvailable(position int64) bool {
+	chunkSize := stream.cache.ChunkSize()
+	index := position / chunkSize
 
-	connection, err := connection.NewConnection(stream.url, streamStartPosition)
-	if err != nil {
-		return err
+	chunk := stream.cache.Get(stream.chunkKey(index))
+	if chunk == nil {
+		return false
 	}
 
-	stream.buffer.ResetToPosition(streamStartPosition)
-	transfer := transfer.NewTransfer(stream.buffer, connection)
-	stream.transfer = transfer
+	return chunk.Filled() > position-index*chunkSize
+}
+
+// findDownload returns an active download of any reader that will reach the position soon
+func (stream *Stream) findDownload(position int64) *download {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	for download := range stream.downloads {
+		if download.covers(position) {
+			return download
+		}
+	}
 
 	return nil
 }
+
+func (stream *Stream) addDownload(download *download) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	stream.downloads[download] = struct{}{}
+}
+
+func (stream *Stream) removeDownload(download *download) {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	delete(stream.downloads, download)
+}
+
+// lookahead is how far downloads may run ahead of the read position, it
+// follows the memory the stream is currently given
+func (stream *Stream) lookahead() int64 {
+	return max(min(calculateBufferSize(stream.size), stream.memory.Limit())/2, stream.cache.ChunkSize())
+}
+
+// alignChunk rounds the position up to the start of the next chunk
+func (stream *Stream) alignChunk(position int64) int64 {
+	chunkSize := stream.cache.ChunkSize()
+
+	return (position + chunkSize - 1) / chunkSize * chunkSize
+}
+
+func (stream *Stream) getNotify() chan struct{} {
+	stream.notifyMu.Lock()
+	defer stream.notifyMu.Unlock()
+
+	return stream.notify
+}
+
+func (stream *Stream) broadcast() {
+	stream.notifyMu.Lock()
+	defer stream.notifyMu.Unlock()
+
+	close(stream.notify)
+	stream.notify = make(chan struct{})
+}
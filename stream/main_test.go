@@ -0,0 +1,264 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/stream/bandwidth"
+	"fuse_video_streamer/stream/connection"
+)
+
+// TestMain runs the tests in a directory with a minimal config file, the
+// stream packages read it on first use
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "stream")
+	if err != nil {
+		panic(err)
+	}
+
+	config := []byte("mount_point: /tmp/fvs\nvolume_name: fvs\n")
+	if err := os.WriteFile(filepath.Join(directory, "config.yml"), config, 0644); err != nil {
+		panic(err)
+	}
+
+	if err := os.Chdir(directory); err != nil {
+		panic(err)
+	}
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+// streamKey returns a key no earlier run of the test cached chunks under
+func streamKey(t testing.TB) string {
+	return fmt.Sprintf("%s-%d", t.Name(), time.Now().UnixNano())
+}
+
+// newContent returns content in which every byte depends on its position
+func newContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	return content
+}
+
+func serveContent(t testing.TB, content []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+// rangeRecorder keeps the start of every range requested from a server
+type rangeRecorder struct {
+	starts []int64
+	mu     sync.Mutex
+}
+
+func (recorder *rangeRecorder) serve(t testing.TB, content []byte) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("Range"), "bytes="), "-")
+		offset, _ := strconv.ParseInt(start, 10, 64)
+
+		recorder.mu.Lock()
+		recorder.starts = append(recorder.starts, offset)
+		recorder.mu.Unlock()
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func (recorder *rangeRecorder) requested(offset int64) bool {
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+
+	for _, start := range recorder.starts {
+		if start >= offset {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newMP4 returns an MP4 file whose moov box follows the media data
+func newMP4(mediaSize int) (content []byte, moovOffset int64) {
+	box := func(kind string, size int) []byte {
+		data := binary.BigEndian.AppendUint32(nil, uint32(size))
+		data = append(data, kind...)
+
+		return append(data, make([]byte, size-8)...)
+	}
+
+	content = append(box("ftyp", 16), box("mdat", mediaSize)...)
+
+	return append(content, box("moov", 64)...), int64(len(content))
+}
+
+// waitUntil polls the condition and fails the test once it did not hold in time
+func waitUntil(t *testing.T, message string, condition func() bool) {
+	t.Helper()
+
+	for deadline := time.Now().Add(5 * time.Second); !condition(); {
+		if time.Now().After(deadline) {
+			t.Fatal(message)
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func resolveTo(urls ...string) Resolver {
+	return func(ctx context.Context, refresh bool) (*Descriptor, error) {
+		descriptor := &Descriptor{}
+		for _, url := range urls {
+			descriptor.Sources = append(descriptor.Sources, connection.Source{Url: url})
+		}
+
+		return descriptor, nil
+	}
+}
+
+func TestChangedStreamKeepsChunksOfItsSuccessor(t *testing.T) {
+	key := streamKey(t)
+	content := newContent(1024)
+	server := serveContent(t, content)
+
+	old, err := New(context.Background(), key, int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old.getOrCreateChunk(0)
+	old.markChanged("test")
+
+	successor, err := New(context.Background(), key, int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer successor.Close()
+
+	if successor.chunks == old.chunks {
+		t.Fatalf("the successor caches its chunks under the changed generation %s", old.chunks)
+	}
+
+	chunk := successor.getOrCreateChunk(0)
+	chunk.WriteAt(content, 0)
+
+	// A late writer of the changed stream stores its outdated chunk
+	old.getOrCreateChunk(0).WriteAt(make([]byte, len(content)), 0)
+
+	old.Close()
+
+	if successor.cache.Get(successor.chunkKey(0)) != chunk {
+		t.Fatalf("closing the changed stream removed the chunk of its successor")
+	}
+
+	if old.cache.Get(old.chunkKey(0)) != nil {
+		t.Fatalf("the chunks of the changed stream are still cached")
+	}
+}
+
+func TestProbedStreamDoesNotPrefetchIndex(t *testing.T) {
+	content, moovOffset := newMP4(16 * 1024 * 1024)
+
+	var recorder rangeRecorder
+	server := recorder.serve(t, content)
+
+	stream, err := New(context.Background(), streamKey(t), int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	reader, err := stream.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	// A scanner reads the header and closes the file again
+	if _, err := reader.ReadAt(make([]byte, 4096), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	if recorder.requested(moovOffset) || stream.container.Load() != nil {
+		t.Fatalf("the index was prefetched while the stream was only probed")
+	}
+
+	stream.escalate()
+
+	waitUntil(t, "the index was not prefetched once the stream escalated", func() bool { return stream.container.Load() != nil })
+
+	if index := stream.container.Load().Index; index.Offset != moovOffset {
+		t.Fatalf("prefetched the index at %d, expected the moov box at %d", index.Offset, moovOffset)
+	}
+}
+
+func TestSuspendDemotesPlayback(t *testing.T) {
+	content := newContent(1024 * 1024)
+	server := serveContent(t, content)
+
+	stream, err := New(context.Background(), streamKey(t), int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	reader, err := stream.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	// The reader already played enough of the stream to count as a player
+	reader.sequential = PlaybackThreshold
+
+	if _, err := reader.ReadAt(make([]byte, 4096), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if stream.bandwidth.Class() != bandwidth.Playback {
+		t.Fatalf("the stream was not promoted")
+	}
+
+	// Wait for the index prefetch the player started, suspend skips streams
+	// that are being read
+	waitUntil(t, "the stream is still being read", func() bool { return stream.reading.Load() == 0 })
+
+	stream.suspend(time.Minute)
+
+	if stream.bandwidth.Class() != bandwidth.Background {
+		t.Fatalf("the suspended stream kept its playback priority")
+	}
+
+	if _, err := reader.ReadAt(make([]byte, 4096), 4096); err != nil {
+		t.Fatal(err)
+	}
+
+	if stream.bandwidth.Class() != bandwidth.Playback {
+		t.Fatalf("the stream was not promoted again when playback continued")
+	}
+}
@@ -4,7 +4,7 @@ import "sync"
 
 type Map sync.Map
 
-func (m *Map) Load(key uint32) (*Stream, bool) {
+func (m *Map) Load(key string) (*Stream, bool) {
 	value, ok := (*sync.Map)(m).Load(key)
 	if !ok {
 		return nil, false
@@ -13,16 +13,26 @@ func (m *Map) Load(key uint32) (*Stream, bool) {
 	return value.(*Stream), true
 }
 
-func (m *Map) Store(key uint32, value *Stream) {
+func (m *Map) Store(key string, value *Stream) {
 	(*sync.Map)(m).Store(key, value)
 }
 
-func (m *Map) Delete(key uint32) {
+func (m *Map) LoadOrStore(key string, value *Stream) (*Stream, bool) {
+	actual, loaded := (*sync.Map)(m).LoadOrStore(key, value)
+
+	return actual.(*Stream), loaded
+}
+
+func (m *Map) CompareAndDelete(key string, value *Stream) bool {
+	return (*sync.Map)(m).CompareAndDelete(key, value)
+}
+
+func (m *Map) Delete(key string) {
 	(*sync.Map)(m).Delete(key)
 }
 
-func (m *Map) Range(f func(key uint32, value *Stream) bool) {
+func (m *Map) Range(f func(key string, value *Stream) bool) {
 	(*sync.Map)(m).Range(func(key, value interface{}) bool {
-		return f(key.(uint32), value.(*Stream))
+		return f(key.(string), value.(*Stream))
 	})
 }
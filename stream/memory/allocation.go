@@ -0,0 +1,44 @@
+package memory
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Allocation is the part of the memory budget that belongs to a stream
+type Allocation struct {
+	manager *Manager
+	stream  string
+
+	limit     atomic.Int64
+	lastUsed  atomic.Int64
+	idle      atomic.Bool
+	suspended atomic.Bool
+}
+
+// Limit is the memory the stream may currently hold
+func (allocation *Allocation) Limit() int64 {
+	return allocation.limit.Load()
+}
+
+// Touch marks the stream as read, an idle or suspended stream gets its share back
+func (allocation *Allocation) Touch() {
+	allocation.lastUsed.Store(time.Now().UnixNano())
+
+	resumed := allocation.suspended.CompareAndSwap(true, false)
+
+	if resumed || allocation.idle.Load() {
+		allocation.manager.Rebalance()
+	}
+}
+
+// Suspend shrinks the allocation to SuspendedLimit until it is touched again
+func (allocation *Allocation) Suspend() {
+	if allocation.suspended.CompareAndSwap(false, true) {
+		allocation.manager.Rebalance()
+	}
+}
+
+func (allocation *Allocation) isIdle(now time.Time) bool {
+	return now.Sub(time.Unix(0, allocation.lastUsed.Load())) > IdleTimeout
+}
@@ -0,0 +1,230 @@
+package memory
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream/cache"
+)
+
+const (
+	DefaultMinimum = int64(8 * 1024 * 1024) // 8MB, the least a stream that is read can work with
+
+	// Streams that were not read for this long give their memory to the others
+	IdleTimeout = 30 * time.Second
+
+	// Memory a suspended stream keeps around its read position to resume quickly
+	SuspendedLimit = int64(4 * 1024 * 1024) // 4MB
+
+	rebalanceInterval = 5 * time.Second
+)
+
+var ErrExhausted = errors.New("memory budget is exhausted")
+
+// Manager divides the memory budget of the cache between the open streams.
+// Every stream gets the stream limit while the budget allows it, under
+// pressure idle streams are shrunk or evicted first and the streams that are
+// read share the rest, new streams are refused once they would not get the
+// minimum anymore
+type Manager struct {
+	cache   *cache.Cache
+	minimum int64
+
+	allocations map[*Allocation]struct{}
+
+	logger *logger.Logger
+
+	mu sync.Mutex
+}
+
+var instance *Manager
+var instanceOnce sync.Once
+
+func GetInstance() *Manager {
+	instanceOnce.Do(func() {
+		logger, err := logger.NewLogger("Memory")
+		if err != nil {
+			panic(err)
+		}
+
+		minimum := DefaultMinimum
+		if minStreamSizeMB := config.GetCache().MinStreamSizeMB; minStreamSizeMB > 0 {
+			minimum = minStreamSizeMB * 1024 * 1024
+		}
+
+		instance = New(cache.GetInstance(), minimum, logger)
+
+		go instance.watch()
+	})
+
+	return instance
+}
+
+func New(cache *cache.Cache, minimum int64, logger *logger.Logger) *Manager {
+	return &Manager{
+		cache:   cache,
+		minimum: min(max(minimum, cache.ChunkSize()), cache.StreamLimit()),
+
+		allocations: make(map[*Allocation]struct{}),
+
+		logger: logger,
+	}
+}
+
+// NewAllocation admits a new stream, it fails with ErrExhausted when the
+// streams that are read could not keep the minimum with one more stream
+func (manager *Manager) NewAllocation(stream string) (*Allocation, error) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	now := time.Now()
+
+	active := 1
+	for allocation := range manager.allocations {
+		if !allocation.isIdle(now) && !allocation.suspended.Load() {
+			active++
+		}
+	}
+
+	if int64(active)*manager.minimum > manager.cache.Limit() {
+		return nil, fmt.Errorf("refusing stream %s, %d streams are read: %w", stream, active-1, ErrExhausted)
+	}
+
+	allocation := &Allocation{
+		manager: manager,
+		stream:  stream,
+	}
+
+	allocation.lastUsed.Store(now.UnixNano())
+	allocation.limit.Store(manager.cache.StreamLimit())
+
+	manager.allocations[allocation] = struct{}{}
+
+	manager.rebalance(now)
+
+	return allocation, nil
+}
+
+func (manager *Manager) Release(allocation *Allocation) {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	if _, ok := manager.allocations[allocation]; !ok {
+		return
+	}
+
+	delete(manager.allocations, allocation)
+
+	// A stream that replaced this one has the same key and keeps its limit
+	if successor := manager.find(allocation.stream); successor != nil {
+		manager.cache.SetStreamLimit(successor.stream, successor.limit.Load())
+	} else {
+		manager.cache.ResetStreamLimit(allocation.stream)
+	}
+
+	manager.rebalance(time.Now())
+}
+
+// find returns another allocation of the stream, the caller holds the lock
+func (manager *Manager) find(stream string) *Allocation {
+	for allocation := range manager.allocations {
+		if allocation.stream == stream {
+			return allocation
+		}
+	}
+
+	return nil
+}
+
+// Rebalance divides the budget again, idle streams are only detected by it
+func (manager *Manager) Rebalance() {
+	manager.mu.Lock()
+	defer manager.mu.Unlock()
+
+	manager.rebalance(time.Now())
+}
+
+func (manager *Manager) rebalance(now time.Time) {
+	budget := manager.cache.Limit()
+	maximum := manager.cache.StreamLimit()
+
+	// Suspended streams keep a fixed small share outside of the division
+	suspendedShare := min(SuspendedLimit, manager.minimum)
+
+	var idle, active []*Allocation
+	for allocation := range manager.allocations {
+		isIdle := allocation.isIdle(now)
+		allocation.idle.Store(isIdle)
+
+		switch {
+		case allocation.suspended.Load():
+			manager.resize(allocation, suspendedShare)
+			budget -= suspendedShare
+		case isIdle:
+			idle = append(idle, allocation)
+		default:
+			active = append(active, allocation)
+		}
+	}
+
+	count := int64(len(idle) + len(active))
+	if count == 0 {
+		return
+	}
+
+	if count*maximum <= budget {
+		for _, allocation := range append(idle, active...) {
+			manager.resize(allocation, maximum)
+		}
+
+		return
+	}
+
+	// Idle streams keep the minimum while everyone fits, otherwise their
+	// chunks are evicted and they download again once they are read
+	idleShare := manager.minimum
+	if count*manager.minimum > budget {
+		idleShare = 0
+	}
+
+	for _, allocation := range idle {
+		manager.resize(allocation, idleShare)
+	}
+
+	if len(active) == 0 {
+		return
+	}
+
+	activeShare := (budget - int64(len(idle))*idleShare) / int64(len(active))
+	activeShare = min(max(activeShare, 0), maximum)
+
+	for _, allocation := range active {
+		manager.resize(allocation, activeShare)
+	}
+}
+
+func (manager *Manager) resize(allocation *Allocation, limit int64) {
+	previous := allocation.limit.Swap(limit)
+	if previous == limit {
+		return
+	}
+
+	manager.cache.SetStreamLimit(allocation.stream, limit)
+
+	if limit < previous {
+		manager.logger.Info(fmt.Sprintf("Shrunk %s from %dMB to %dMB", allocation.stream, previous>>20, limit>>20))
+	}
+}
+
+func (manager *Manager) watch() {
+	ticker := time.NewTicker(rebalanceInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		manager.Rebalance()
+	}
+}
@@ -0,0 +1,165 @@
+package memory
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream/cache"
+)
+
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "memory")
+	if err != nil {
+		panic(err)
+	}
+
+	logger.LogDir = filepath.Join(directory, "logs")
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+const megabyte = int64(1024 * 1024)
+
+func newManager(t *testing.T, limit int64, streamLimit int64, minimum int64) *Manager {
+	logger, err := logger.NewLogger("Memory Test")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return New(cache.New(megabyte, limit, streamLimit), minimum, logger)
+}
+
+// cached fills the stream with chunks and returns how many the cache kept
+func cached(manager *Manager, stream string, chunks int) int {
+	for index := range chunks {
+		manager.cache.Put(cache.Key{Stream: stream, Index: int64(index)}, cache.NewCompleteChunk(make([]byte, megabyte)))
+	}
+
+	kept := 0
+	for index := range chunks {
+		if manager.cache.Get(cache.Key{Stream: stream, Index: int64(index)}) != nil {
+			kept++
+		}
+	}
+
+	manager.cache.Remove(stream)
+
+	return kept
+}
+
+func newAllocation(t *testing.T, manager *Manager, stream string) *Allocation {
+	allocation, err := manager.NewAllocation(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return allocation
+}
+
+func expectLimit(t *testing.T, name string, allocation *Allocation, expected int64) {
+	t.Helper()
+
+	if allocation.Limit() != expected {
+		t.Fatalf("%s has %dMB, expected %dMB", name, allocation.Limit()/megabyte, expected/megabyte)
+	}
+}
+
+func TestReleaseKeepsLimitOfSuccessor(t *testing.T) {
+	manager := newManager(t, 64*megabyte, 16*megabyte, 8*megabyte)
+
+	replaced := newAllocation(t, manager, "a")
+	successor := newAllocation(t, manager, "a")
+
+	successor.Suspend()
+
+	expectLimit(t, "successor", successor, SuspendedLimit)
+
+	manager.Release(replaced)
+
+	if kept := cached(manager, "a", 8); int64(kept)*megabyte != SuspendedLimit {
+		t.Fatalf("the cache kept %d chunks of the successor, its limit is %dMB", kept, SuspendedLimit/megabyte)
+	}
+
+	manager.Release(successor)
+
+	if kept := cached(manager, "a", 32); int64(kept)*megabyte != manager.cache.StreamLimit() {
+		t.Fatalf("the cache kept %d chunks after the last allocation was released", kept)
+	}
+}
+
+func TestRebalance(t *testing.T) {
+	manager := newManager(t, 32*megabyte, 16*megabyte, 8*megabyte)
+
+	idle := newAllocation(t, manager, "idle")
+	suspended := newAllocation(t, manager, "suspended")
+	active := newAllocation(t, manager, "active")
+
+	// Three streams at the stream limit do not fit, none is idle yet
+	for name, allocation := range map[string]*Allocation{"idle": idle, "suspended": suspended, "active": active} {
+		expectLimit(t, name, allocation, 32*megabyte/3)
+	}
+
+	idle.lastUsed.Store(time.Now().Add(-2 * IdleTimeout).UnixNano())
+	suspended.Suspend()
+
+	// The suspended stream keeps its small share, the idle one the minimum and
+	// the active one gets the rest up to the stream limit
+	expectLimit(t, "suspended", suspended, SuspendedLimit)
+	expectLimit(t, "idle", idle, 8*megabyte)
+	expectLimit(t, "active", active, 16*megabyte)
+
+	if kept := cached(manager, "idle", 16); int64(kept)*megabyte != 8*megabyte {
+		t.Fatalf("the cache kept %d chunks of the idle stream", kept)
+	}
+
+	idle.Touch()
+
+	expectLimit(t, "touched", idle, 14*megabyte)
+	expectLimit(t, "active", active, 14*megabyte)
+
+	suspended.Touch()
+
+	for name, allocation := range map[string]*Allocation{"idle": idle, "suspended": suspended, "active": active} {
+		expectLimit(t, name, allocation, 32*megabyte/3)
+	}
+}
+
+func TestRebalanceEvictsIdleStreamsUnderPressure(t *testing.T) {
+	manager := newManager(t, 16*megabyte, 16*megabyte, 8*megabyte)
+
+	idle := newAllocation(t, manager, "idle")
+	active := newAllocation(t, manager, "active")
+
+	idle.lastUsed.Store(time.Now().Add(-2 * IdleTimeout).UnixNano())
+
+	third := newAllocation(t, manager, "third")
+
+	// The idle stream would not keep the minimum with three streams
+	expectLimit(t, "idle", idle, 0)
+	expectLimit(t, "active", active, 8*megabyte)
+	expectLimit(t, "third", third, 8*megabyte)
+}
+
+func TestNewAllocationExhausted(t *testing.T) {
+	manager := newManager(t, 16*megabyte, 16*megabyte, 8*megabyte)
+
+	first := newAllocation(t, manager, "first")
+	newAllocation(t, manager, "second")
+
+	if _, err := manager.NewAllocation("third"); !errors.Is(err, ErrExhausted) {
+		t.Fatalf("expected the budget to be exhausted, got %v", err)
+	}
+
+	first.Suspend()
+
+	if _, err := manager.NewAllocation("third"); err != nil {
+		t.Fatalf("suspended streams do not count against new ones: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package stream
+
+import (
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"fuse_video_streamer/stream/connection"
+	"fuse_video_streamer/stream/transfer"
+)
+
+const (
+	mirrorCooldown = 30 * time.Second
+
+	// Minimum amount of bytes before a throughput sample is used
+	minimumSample = int64(256 * 1024)
+)
+
+type mirror struct {
+	// Bytes per second, zero when the mirror was not measured yet
+	throughput float64
+
+	failures int
+	failedAt time.Time
+
+	// Set when the server rejected the url, it is not used again until the
+	// descriptor is resolved again
+	expired bool
+}
+
+// mirrors ranks the sources of a stream by their throughput and recent
+// failures, transfers use it to move to another source when one fails
+type mirrors struct {
+	stream *Stream
+
+	stats map[string]*mirror
+
+	// When the descriptor was last resolved again
+	resolvedAt time.Time
+
+	mu sync.Mutex
+}
+
+var _ transfer.Sources = &mirrors{}
+
+func newMirrors(stream *Stream) *mirrors {
+	return &mirrors{
+		stream: stream,
+		stats:  make(map[string]*mirror),
+	}
+}
+
+// ranked returns the sources from best to worst, sources that expired or
+// failed recently come last and sources that were not measured yet are tried
+// first
+func (mirrors *mirrors) ranked(sources []connection.Source) []connection.Source {
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	now := time.Now()
+
+	score := func(source connection.Source) (bool, float64) {
+		mirror, ok := mirrors.stats[source.Url]
+		if !ok {
+			return false, -1
+		}
+
+		cooldown := mirrorCooldown * time.Duration(min(mirror.failures, 10))
+		penalized := mirror.expired || mirror.failures > 0 && now.Sub(mirror.failedAt) < cooldown
+
+		if mirror.throughput == 0 {
+			return penalized, -1
+		}
+
+		return penalized, mirror.throughput
+	}
+
+	ranked := slices.Clone(sources)
+
+	slices.SortStableFunc(ranked, func(a connection.Source, b connection.Source) int {
+		penalizedA, throughputA := score(a)
+		penalizedB, throughputB := score(b)
+
+		switch {
+		case penalizedA != penalizedB && penalizedA:
+			return 1
+		case penalizedA != penalizedB:
+			return -1
+		case throughputA < 0 && throughputB >= 0:
+			return -1
+		case throughputB < 0 && throughputA >= 0:
+			return 1
+		case throughputA > throughputB:
+			return -1
+		case throughputA < throughputB:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return ranked
+}
+
+func (mirrors *mirrors) get(url string) *mirror {
+	stats, ok := mirrors.stats[url]
+	if !ok {
+		stats = &mirror{}
+		mirrors.stats[url] = stats
+	}
+
+	return stats
+}
+
+// penalize moves the source to the back of the ranking for a while
+func (mirrors *mirrors) penalize(url string) {
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	mirror := mirrors.get(url)
+	mirror.failures++
+	mirror.failedAt = time.Now()
+}
+
+func (mirrors *mirrors) reset() {
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	clear(mirrors.stats)
+	mirrors.resolvedAt = time.Now()
+}
+
+// recentlyResolved reports whether the descriptor was resolved again within
+// the cooldown, sources that expire right away are not resolved once more
+func (mirrors *mirrors) recentlyResolved() bool {
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	return !mirrors.resolvedAt.IsZero() && time.Since(mirrors.resolvedAt) < mirrorCooldown
+}
+
+// Report records the throughput of the source
+func (mirrors *mirrors) Report(source connection.Source, received int64, elapsed time.Duration) {
+	if received < minimumSample || elapsed <= 0 {
+		return
+	}
+
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	mirror := mirrors.get(source.Url)
+
+	throughput := float64(received) / elapsed.Seconds()
+	if mirror.throughput == 0 {
+		mirror.throughput = throughput
+	} else {
+		mirror.throughput = mirror.throughput*0.7 + throughput*0.3
+	}
+
+	mirror.failures = 0
+}
+
+// expire marks the source as rejected by the server and returns the best
+// source that was not, false when every source expired
+func (mirrors *mirrors) expire(failed connection.Source, sources []connection.Source) (connection.Source, bool) {
+	mirrors.mu.Lock()
+	mirrors.get(failed.Url).expired = true
+	mirrors.mu.Unlock()
+
+	best := mirrors.ranked(sources)[0]
+
+	mirrors.mu.Lock()
+	defer mirrors.mu.Unlock()
+
+	return best, !mirrors.get(best.Url).expired
+}
+
+// Failover penalizes the failed source and returns the best source to
+// continue on. An expired source fails over to the other sources, the
+// descriptor is only resolved again once all of them expired.
+func (mirrors *mirrors) Failover(failed connection.Source, err error) (connection.Source, error) {
+	mirrors.penalize(failed.Url)
+
+	if connection.IsExpired(err) {
+		sources, err := mirrors.stream.sources()
+		if err != nil {
+			return connection.Source{}, err
+		}
+
+		if source, ok := mirrors.expire(failed, sources); ok {
+			mirrors.stream.logger.Warn(fmt.Sprintf("Source of %s expired, failing over to another source", mirrors.stream.key))
+			return source, nil
+		}
+
+		if mirrors.recentlyResolved() {
+			return connection.Source{}, fmt.Errorf("every source of %s expired", mirrors.stream.key)
+		}
+
+		return mirrors.stream.refreshSource(failed)
+	}
+
+	source, err := mirrors.stream.source()
+	if err != nil {
+		return connection.Source{}, err
+	}
+
+	if source.Url != failed.Url {
+		mirrors.stream.logger.Warn(fmt.Sprintf("Failing over %s to another source", mirrors.stream.key))
+	}
+
+	return source, nil
+}
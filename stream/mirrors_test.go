@@ -0,0 +1,150 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/stream/connection"
+)
+
+func urls(sources []connection.Source) []string {
+	urls := make([]string, 0, len(sources))
+	for _, source := range sources {
+		urls = append(urls, source.Url)
+	}
+
+	return urls
+}
+
+func resolveSources(urls ...string) []connection.Source {
+	sources := make([]connection.Source, 0, len(urls))
+	for _, url := range urls {
+		sources = append(sources, connection.Source{Url: url})
+	}
+
+	return sources
+}
+
+func expectRanking(t *testing.T, mirrors *mirrors, sources []connection.Source, expected ...string) {
+	t.Helper()
+
+	ranked := urls(mirrors.ranked(sources))
+
+	for i := range expected {
+		if ranked[i] != expected[i] {
+			t.Fatalf("ranked %v, expected %v", ranked, expected)
+		}
+	}
+}
+
+func TestRankedOrdersByThroughput(t *testing.T) {
+	mirrors := newMirrors(nil)
+	sources := resolveSources("a", "b", "c", "d")
+
+	mirrors.Report(connection.Source{Url: "a"}, 1024*1024, time.Second)
+	mirrors.Report(connection.Source{Url: "b"}, 4*1024*1024, time.Second)
+	mirrors.Report(connection.Source{Url: "d"}, 2*1024*1024, time.Second)
+
+	// Unmeasured sources are tried first, then the fastest
+	expectRanking(t, mirrors, sources, "c", "b", "d", "a")
+
+	// Samples that are too small to measure are ignored
+	mirrors.Report(connection.Source{Url: "c"}, minimumSample-1, time.Millisecond)
+
+	expectRanking(t, mirrors, sources, "c", "b", "d", "a")
+}
+
+func TestPenalizeMovesSourceBackForCooldown(t *testing.T) {
+	mirrors := newMirrors(nil)
+	sources := resolveSources("a", "b", "c")
+
+	mirrors.Report(connection.Source{Url: "a"}, 4*1024*1024, time.Second)
+	mirrors.Report(connection.Source{Url: "b"}, 2*1024*1024, time.Second)
+	mirrors.Report(connection.Source{Url: "c"}, 1024*1024, time.Second)
+
+	mirrors.penalize("a")
+
+	expectRanking(t, mirrors, sources, "b", "c", "a")
+
+	// The cooldown grows with every failure
+	mirrors.penalize("a")
+	mirrors.stats["a"].failedAt = time.Now().Add(-mirrorCooldown - time.Second)
+
+	expectRanking(t, mirrors, sources, "b", "c", "a")
+
+	mirrors.stats["a"].failedAt = time.Now().Add(-2*mirrorCooldown - time.Second)
+
+	expectRanking(t, mirrors, sources, "a", "b", "c")
+
+	// A good sample clears the failures
+	mirrors.penalize("b")
+	mirrors.Report(connection.Source{Url: "b"}, 2*1024*1024, time.Second)
+
+	expectRanking(t, mirrors, sources, "a", "b", "c")
+}
+
+func TestFailoverMovesToNextSource(t *testing.T) {
+	stream := newStream(t, 1024, Options{})
+	stream.descriptor = &Descriptor{Sources: resolveSources("a", "b")}
+
+	source, err := stream.mirrors.Failover(connection.Source{Url: "a"}, errors.New("connection reset"))
+	if err != nil || source.Url != "b" {
+		t.Fatalf("failed over to %q: %v", source.Url, err)
+	}
+
+	// With both penalized the one that failed longer ago is preferred again
+	stream.mirrors.stats["a"].failedAt = time.Now().Add(-mirrorCooldown - time.Second)
+
+	source, err = stream.mirrors.Failover(connection.Source{Url: "b"}, errors.New("connection reset"))
+	if err != nil || source.Url != "a" {
+		t.Fatalf("failed over to %q: %v", source.Url, err)
+	}
+}
+
+func TestFailoverResolvesOnceEverySourceExpired(t *testing.T) {
+	var resolves atomic.Int32
+
+	resolve := func(ctx context.Context, refresh bool) (*Descriptor, error) {
+		if !refresh {
+			return &Descriptor{Sources: resolveSources("a", "b")}, nil
+		}
+
+		resolves.Add(1)
+
+		return &Descriptor{Sources: resolveSources("c", "d")}, nil
+	}
+
+	stream, err := New(context.Background(), streamKey(t), 1024, Options{}, resolve)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	expired := &connection.StatusError{StatusCode: http.StatusForbidden}
+
+	// An expired source fails over to the other one without resolving
+	source, err := stream.mirrors.Failover(connection.Source{Url: "a"}, expired)
+	if err != nil || source.Url != "b" || resolves.Load() != 0 {
+		t.Fatalf("failed over to %q after %d resolves: %v", source.Url, resolves.Load(), err)
+	}
+
+	source, err = stream.mirrors.Failover(connection.Source{Url: "b"}, expired)
+	if err != nil || resolves.Load() != 1 {
+		t.Fatalf("failed over to %q after %d resolves: %v", source.Url, resolves.Load(), err)
+	}
+
+	if source.Url != "c" && source.Url != "d" {
+		t.Fatalf("failed over to %q, expected a source of the new descriptor", source.Url)
+	}
+
+	// Sources that expire right after resolving are not resolved again
+	stream.mirrors.Failover(connection.Source{Url: "c"}, expired)
+
+	if _, err := stream.mirrors.Failover(connection.Source{Url: "d"}, expired); err == nil || resolves.Load() != 1 {
+		t.Fatalf("expected to give up after %d resolves: %v", resolves.Load(), err)
+	}
+}
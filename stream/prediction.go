@@ -0,0 +1,105 @@
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"fuse_video_streamer/stream/container"
+)
+
+const maxPredictions = 8
+
+// prediction keeps track of the regions prefetched around keyframes where a
+// scrubbing player is expected to seek to next
+type prediction struct {
+	ranges []container.Range
+
+	predicted atomic.Int64
+	hits      atomic.Int64
+
+	running atomic.Bool
+
+	mu sync.Mutex
+}
+
+type Stats struct {
+	Container      string
+	Keyframes      int
+	Predicted      int64
+	PredictionHits int64
+}
+
+func (stream *Stream) Stats() Stats {
+	stats := Stats{
+		Container:      container.Unknown.String(),
+		Predicted:      stream.prediction.predicted.Load(),
+		PredictionHits: stream.prediction.hits.Load(),
+	}
+
+	if info := stream.container.Load(); info != nil {
+		stats.Container = info.Format.String()
+		stats.Keyframes = len(info.Keyframes)
+	}
+
+	return stats
+}
+
+// onSeek is called when a reader jumps from the previous to the new position,
+// the next seek is expected at the same distance in the same direction
+func (stream *Stream) onSeek(previous int64, position int64) {
+	prediction := &stream.prediction
+
+	prediction.mu.Lock()
+	for i, predicted := range prediction.ranges {
+		if position >= predicted.Offset && position < predicted.Offset+predicted.Length {
+			prediction.hits.Add(1)
+			prediction.ranges = append(prediction.ranges[:i], prediction.ranges[i+1:]...)
+			break
+		}
+	}
+	prediction.mu.Unlock()
+
+	info := stream.container.Load()
+	if info == nil || len(info.Keyframes) == 0 {
+		return
+	}
+
+	target := position + (position - previous)
+	if target < 0 || target >= stream.size {
+		return
+	}
+
+	keyframe, ok := info.NearestKeyframe(target)
+	if !ok || stream.isAvailable(keyframe) {
+		return
+	}
+
+	if !prediction.running.CompareAndSwap(false, true) {
+		return // Still busy with the previous prediction
+	}
+
+	window := container.Range{
+		Offset: keyframe,
+		Length: min(2*stream.cache.ChunkSize(), stream.size-keyframe),
+	}
+
+	prediction.mu.Lock()
+	prediction.ranges = append(prediction.ranges, window)
+	if len(prediction.ranges) > maxPredictions {
+		prediction.ranges = prediction.ranges[1:]
+	}
+	prediction.mu.Unlock()
+
+	prediction.predicted.Add(1)
+
+	go func() {
+		defer prediction.running.Store(false)
+
+		reader := newReader(stream)
+		reader.detached = true
+
+		defer reader.Close()
+
+		reader.readRange(window.Offset, window.Length)
+	}()
+}
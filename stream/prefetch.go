@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"fmt"
+
+	"fuse_video_streamer/stream/container"
+)
+
+const MaxPrefetchSize = int64(32 * 1024 * 1024) // 32MB
+
+// prefetch detects the container of the stream and downloads its index in the
+// background, so a player seeking through the file does not wait for it. It
+// runs once the stream escalates, streams that are only probed never fetch
+// more than the probes read.
+func (stream *Stream) prefetch() {
+	reader := newReader(stream)
+	reader.detached = true
+
+	defer reader.Close()
+
+	info, err := container.Probe(reader, stream.size)
+	if err != nil {
+		return
+	}
+
+	if info.Index.Length > MaxPrefetchSize {
+		reader.readRange(info.Index.Offset, MaxPrefetchSize)
+		stream.container.Store(info)
+		return
+	}
+
+	index := make([]byte, info.Index.Length)
+
+	_, err = reader.ReadAt(index, info.Index.Offset)
+	if err != nil {
+		stream.container.Store(info)
+		return
+	}
+
+	err = info.ParseKeyframes(index)
+	if err != nil {
+		stream.logger.Warn(fmt.Sprintf("Failed to parse %s keyframes of %s: %v", info.Format, stream.key, err))
+	}
+
+	stream.container.Store(info)
+}
+
+// readRange reads the range through the reader so it ends up in the cache
+func (reader *Reader) readRange(offset int64, length int64) error {
+	buffer := make([]byte, min(length, reader.stream.cache.ChunkSize()))
+
+	for position := offset; position < offset+length; {
+		size := min(int64(len(buffer)), offset+length-position)
+
+		n, err := reader.ReadAt(buffer[:size], position)
+		if err != nil {
+			return err
+		}
+
+		position += int64(n)
+	}
+
+	return nil
+}
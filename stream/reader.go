@@ -0,0 +1,328 @@
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Bytes a handle reads without seeking before its stream is treated as playback
+	PlaybackThreshold = int64(16 * 1024 * 1024)
+
+	// Bytes a handle reads without seeking before its stream leaves probe mode
+	StreamingThreshold = int64(8 * 1024 * 1024)
+
+	// Alignment and bounds of the ranges requested in probe mode
+	ProbeSize    = int64(128 * 1024)
+	MaxProbeSize = int64(2 * 1024 * 1024)
+
+	// Longest a read waits for data unless its context ends earlier
+	WaitTimeout = 10 * time.Second
+)
+
+var (
+	errDownloadEnded = errors.New("download ended")
+
+	// ErrClosed is returned by reads of a closed reader or stream
+	ErrClosed = errors.New("stream is closed")
+
+	// ErrTimeout is returned when a read waited WaitTimeout without data
+	ErrTimeout = errors.New("timeout waiting for the buffer to fill")
+)
+
+// Reader is the view of a single handle on a shared stream, it has its own
+// read position and download while the downloaded chunks are shared. Reads
+// may run concurrently, the mutex only guards the read state and is never
+// held while waiting for data.
+type Reader struct {
+	stream *Stream
+
+	download *download
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// Detached readers are used internally and do not keep the stream open
+	detached bool
+
+	// End of the previous read, used to detect seeks
+	lastPosition int64
+
+	// Bytes read since the last seek, used to recognise playback
+	sequential int64
+
+	mu sync.Mutex
+
+	closed atomic.Bool
+}
+
+func newReader(stream *Stream) *Reader {
+	ctx, cancel := context.WithCancel(stream.ctx)
+
+	return &Reader{
+		stream: stream,
+
+		ctx:    ctx,
+		cancel: cancel,
+
+		lastPosition: -1,
+	}
+}
+
+func (reader *Reader) ReadAt(p []byte, seekPosition int64) (int, error) {
+	return reader.ReadAtContext(context.Background(), p, seekPosition)
+}
+
+// ReadAtContext reads like ReadAt, waiting for data stops with the error of
+// the context once it is done
+func (reader *Reader) ReadAtContext(ctx context.Context, p []byte, seekPosition int64) (int, error) {
+	stream := reader.stream
+
+	if reader.isClosed() || stream.isClosed() {
+		return 0, ErrClosed
+	}
+
+	if err := stream.changedError(); err != nil {
+		return 0, err
+	}
+
+	if seekPosition >= stream.size {
+		return 0, io.EOF
+	}
+
+	stream.reading.Add(1)
+	defer stream.reading.Add(-1)
+
+	stream.resume()
+
+	requestedPosition := min(seekPosition+int64(len(p)), stream.size)
+
+	reader.track(seekPosition, requestedPosition)
+
+	bytesRead := 0
+	refetched := false
+
+	for position := seekPosition; position < requestedPosition; {
+		n := stream.readCached(p[bytesRead:requestedPosition-seekPosition], position)
+		if n > 0 {
+			bytesRead += n
+			position += int64(n)
+			refetched = false
+			continue
+		}
+
+		download, err := reader.fetch(position, requestedPosition)
+		if err != nil {
+			return bytesRead, err
+		}
+
+		err = reader.waitForPosition(ctx, download, position)
+		download.release()
+
+		if err == errDownloadEnded && !refetched {
+			// The download completed but the chunk was evicted in the meantime
+			refetched = true
+			continue
+		}
+
+		if err != nil {
+			return bytesRead, err
+		}
+	}
+
+	if bytesRead < len(p) {
+		return bytesRead, io.EOF
+	}
+
+	return bytesRead, nil
+}
+
+// track updates the read state of the reader, seeks and sequential reads
+// decide how the stream is downloaded
+func (reader *Reader) track(seekPosition int64, requestedPosition int64) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	stream := reader.stream
+
+	if !reader.detached && reader.lastPosition >= 0 && abs(seekPosition-reader.lastPosition) > stream.cache.ChunkSize() {
+		stream.onSeek(reader.lastPosition, seekPosition)
+		reader.sequential = 0
+	}
+
+	reader.sequential += requestedPosition - seekPosition
+	if !reader.detached && reader.sequential >= StreamingThreshold {
+		stream.escalate()
+	}
+
+	if !reader.detached && reader.sequential >= PlaybackThreshold {
+		stream.promote()
+	}
+
+	reader.lastPosition = requestedPosition
+
+	if reader.download != nil {
+		reader.download.follow(seekPosition)
+	}
+}
+
+func (reader *Reader) Close() error {
+	if !reader.closed.CompareAndSwap(false, true) {
+		return nil // Already closed
+	}
+
+	reader.cancel()
+
+	reader.mu.Lock()
+	reader.closeDownload()
+	reader.mu.Unlock()
+
+	if !reader.detached {
+		reader.stream.release()
+	}
+
+	return nil
+}
+
+func (reader *Reader) isClosed() bool {
+	return reader.closed.Load()
+}
+
+// fetch returns a download that will reach the position soon, this is either
+// a running download of any reader of the stream or a new download of this
+// reader. Until the stream is streaming, only a probe up to a little past the
+// requested position is downloaded. The download is acquired and has to be
+// released once the read stops waiting for it.
+func (reader *Reader) fetch(position int64, requestedPosition int64) (*download, error) {
+	reader.mu.Lock()
+	defer reader.mu.Unlock()
+
+	stream := reader.stream
+
+	if download := stream.findDownload(position); download != nil && download.acquire() {
+		download.setReadPosition(position)
+		return download, nil
+	}
+
+	chunkSize := stream.cache.ChunkSize()
+	startPosition := position / chunkSize * chunkSize
+
+	// Another read waits for the download of the reader, this region is
+	// fetched by a probe of its own that ends with the read
+	concurrent := reader.download != nil && reader.download.isWaited()
+
+	endPosition := stream.size
+	if !stream.isStreaming() || concurrent {
+		// Probes grow with sequential reads like the readahead of a kernel
+		length := max(requestedPosition-position, min(max(reader.sequential, ProbeSize), MaxProbeSize))
+		endPosition = min((position+length+ProbeSize-1)/ProbeSize*ProbeSize, stream.size)
+	}
+
+	if concurrent {
+		download := newProbe(stream, startPosition, endPosition)
+		stream.addDownload(download)
+
+		download.acquire()
+		download.retire()
+
+		return download, nil
+	}
+
+	err := reader.newDownload(startPosition, endPosition)
+	if err != nil {
+		return nil, err
+	}
+
+	reader.download.acquire()
+	reader.download.setReadPosition(position)
+
+	return reader.download, nil
+}
+
+func (reader *Reader) waitForPosition(requestCtx context.Context, download *download, position int64) error {
+	stream := reader.stream
+
+	ctx, cancel := context.WithTimeout(reader.ctx, WaitTimeout)
+	defer cancel()
+
+	stop := context.AfterFunc(requestCtx, cancel)
+	defer stop()
+
+	for {
+		notify := stream.getNotify()
+
+		if err := stream.changedError(); err != nil {
+			return err
+		}
+
+		if stream.isAvailable(position) {
+			return nil
+		}
+
+		if download.isFailed() {
+			return fmt.Errorf("download failed before reaching position %d: %w", position, download.failure())
+		}
+
+		if download.isClosed() {
+			return errDownloadEnded
+		}
+
+		select {
+		case <-notify:
+		case <-ctx.Done():
+			if err := requestCtx.Err(); err != nil {
+				return err
+			}
+
+			if reader.isClosed() || stream.isClosed() {
+				return ErrClosed
+			}
+
+			return ErrTimeout
+		}
+	}
+}
+
+func (reader *Reader) newDownload(startPosition int64, endPosition int64) error {
+	stream := reader.stream
+
+	if stream.isClosed() {
+		return ErrClosed
+	}
+
+	reader.closeDownload()
+
+	if endPosition < stream.size {
+		reader.download = newProbe(stream, startPosition, endPosition)
+	} else {
+		reader.download = newDownload(stream, startPosition)
+	}
+	stream.addDownload(reader.download)
+
+	return nil
+}
+
+// closeDownload lets go of the download of the reader, it keeps running for
+// the reads that still wait for it
+func (reader *Reader) closeDownload() {
+	if reader.download == nil {
+		return
+	}
+
+	reader.download.retire()
+
+	reader.download = nil
+}
+
+func abs(value int64) int64 {
+	if value < 0 {
+		return -value
+	}
+
+	return value
+}
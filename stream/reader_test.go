@@ -0,0 +1,139 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openReader(t *testing.T, stream *Stream) *Reader {
+	reader, err := stream.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { reader.Close() })
+
+	return reader
+}
+
+func TestConcurrentReadsOnOneReader(t *testing.T) {
+	content := newContent(8 * 1024 * 1024)
+	server := serveContent(t, content)
+
+	stream, err := New(context.Background(), streamKey(t), int64(len(content)), Options{Connections: 4}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	reader := openReader(t, stream)
+
+	const readers = 8
+	const size = 64 * 1024
+
+	errs := make(chan error, readers)
+
+	var wg sync.WaitGroup
+	for i := range readers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			// Every goroutine reads its own region of the file sequentially
+			start := int64(i) * int64(len(content)) / readers
+
+			p := make([]byte, size)
+			for offset := start; offset < start+16*size; offset += size {
+				if _, err := reader.ReadAt(p, offset); err != nil {
+					errs <- err
+					return
+				}
+
+				if !bytes.Equal(p, content[offset:offset+size]) {
+					t.Errorf("read at %d returned other bytes", offset)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Fatal(err)
+	}
+}
+
+func TestSlowReadDoesNotBlockOtherReads(t *testing.T) {
+	content := newContent(8 * 1024 * 1024)
+	slow := len(content) / 2
+
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Ranges in the second half wait until the test releases them
+		if !strings.HasPrefix(r.Header.Get("Range"), "bytes=0-") {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+				return
+			}
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+	t.Cleanup(func() { close(release) })
+
+	stream, err := New(context.Background(), streamKey(t), int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	reader := openReader(t, stream)
+
+	slowRead := make(chan error, 1)
+	go func() {
+		p := make([]byte, 4096)
+		_, err := reader.ReadAt(p, int64(slow))
+		if err == nil && !bytes.Equal(p, content[slow:slow+len(p)]) {
+			t.Errorf("the slow read returned other bytes")
+		}
+
+		slowRead <- err
+	}()
+
+	waitUntil(t, "the slow read did not start", func() bool { return stream.reading.Load() > 0 })
+
+	p := make([]byte, 4096)
+	if _, err := reader.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(p, content[:len(p)]) {
+		t.Fatalf("the read returned other bytes")
+	}
+
+	select {
+	case err := <-slowRead:
+		t.Fatalf("the slow read ended before its range was served: %v", err)
+	default:
+	}
+
+	release <- struct{}{}
+
+	select {
+	case err := <-slowRead:
+		if err != nil {
+			t.Fatalf("the slow read failed: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("the slow read did not finish")
+	}
+}
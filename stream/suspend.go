@@ -0,0 +1,77 @@
+package stream
+
+import (
+	"fmt"
+	"time"
+)
+
+const DefaultSuspendAfter = 2 * time.Minute
+
+// Streams that were not read for this long lose their playback priority, a
+// paused player gets it back with its next read
+const PlaybackIdleTimeout = 30 * time.Second
+
+// watchIdle demotes the stream once a player stopped reading it and suspends
+// it once it was not read for the configured period
+func (stream *Stream) watchIdle() {
+	interval := PlaybackIdleTimeout / 4
+	if stream.options.SuspendAfter > 0 {
+		interval = min(interval, max(stream.options.SuspendAfter/4, time.Second))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-stream.ctx.Done():
+			return
+		}
+
+		idle := time.Since(time.Unix(0, stream.lastRead.Load()))
+		if idle >= PlaybackIdleTimeout && stream.reading.Load() == 0 {
+			stream.demote()
+		}
+
+		if stream.options.SuspendAfter > 0 && idle >= stream.options.SuspendAfter {
+			stream.suspend(idle)
+		}
+	}
+}
+
+// suspend closes the downloads of every reader and releases most of the
+// buffer, the descriptor, mirrors and container index are kept
+func (stream *Stream) suspend(idle time.Duration) {
+	if stream.reading.Load() > 0 || !stream.suspended.CompareAndSwap(false, true) {
+		return
+	}
+
+	stream.mu.Lock()
+	downloads := make([]*download, 0, len(stream.downloads))
+	for download := range stream.downloads {
+		downloads = append(downloads, download)
+	}
+	clear(stream.downloads)
+	stream.mu.Unlock()
+
+	for _, download := range downloads {
+		download.Close()
+	}
+
+	stream.memory.Suspend()
+	stream.demote()
+
+	stream.logger.Info(fmt.Sprintf("Suspended %s after %s without reads", stream.key, idle.Round(time.Second)))
+}
+
+// resume is called by every read, the readers start new downloads from their
+// read position when they find theirs closed
+func (stream *Stream) resume() {
+	stream.lastRead.Store(time.Now().UnixNano())
+	stream.memory.Touch()
+
+	if stream.suspended.CompareAndSwap(true, false) {
+		stream.logger.Info(fmt.Sprintf("Resumed %s", stream.key))
+	}
+}
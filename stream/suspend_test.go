@@ -0,0 +1,99 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/stream/memory"
+)
+
+func downloads(stream *Stream) int {
+	stream.mu.Lock()
+	defer stream.mu.Unlock()
+
+	return len(stream.downloads)
+}
+
+func TestSuspendClosesDownloadsAndResumeReadsOn(t *testing.T) {
+	content := newContent(4 * 1024 * 1024)
+	server := serveContent(t, content)
+
+	stream, err := New(context.Background(), streamKey(t), int64(len(content)), Options{}, resolveTo(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	reader, err := stream.NewReader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	stream.escalate()
+
+	p := make([]byte, 64*1024)
+	if _, err := reader.ReadAt(p, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	waitUntil(t, "the stream is still being read", func() bool { return stream.reading.Load() == 0 })
+
+	download := reader.download
+	if download == nil || downloads(stream) == 0 {
+		t.Fatalf("the read did not start a download")
+	}
+
+	stream.suspend(time.Minute)
+
+	if !stream.suspended.Load() || !download.isClosed() || downloads(stream) != 0 {
+		t.Fatalf("the suspended stream kept its downloads")
+	}
+
+	if stream.memory.Limit() > memory.SuspendedLimit {
+		t.Fatalf("the suspended stream kept %d bytes of memory", stream.memory.Limit())
+	}
+
+	// The reader starts a new download from its read position
+	if _, err := reader.ReadAt(p, 2*1024*1024); err != nil {
+		t.Fatal(err)
+	}
+
+	if stream.suspended.Load() {
+		t.Fatalf("the stream was not resumed by the read")
+	}
+
+	if !bytes.Equal(p, content[2*1024*1024:2*1024*1024+len(p)]) {
+		t.Fatalf("the resumed read returned other bytes")
+	}
+
+	if reader.download == download || downloads(stream) == 0 {
+		t.Fatalf("the resumed read did not start a new download")
+	}
+}
+
+func TestSuspendSkipsStreamsBeingRead(t *testing.T) {
+	stream := newStream(t, 1024, Options{})
+
+	stream.reading.Add(1)
+	stream.suspend(time.Minute)
+	stream.reading.Add(-1)
+
+	if stream.suspended.Load() {
+		t.Fatalf("a stream was suspended during a read")
+	}
+}
+
+func TestIdleStreamIsSuspended(t *testing.T) {
+	stream := newStream(t, 1024, Options{SuspendAfter: 100 * time.Millisecond})
+
+	waitUntil(t, "the idle stream was not suspended", stream.suspended.Load)
+
+	stream.resume()
+
+	if stream.suspended.Load() {
+		t.Fatalf("the stream was not resumed")
+	}
+}
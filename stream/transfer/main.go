@@ -6,23 +6,72 @@ import (
 	"fuse_video_streamer/logger"
 	"fuse_video_streamer/stream/connection"
 	"io"
+	"os"
 	"strings"
 	"sync"
 	"sync/atomic"
+	"time"
+)
+
+const (
+	MaxRetries     = 5
+	InitialBackoff = 250 * time.Millisecond
+	MaxBackoff     = 8 * time.Second
+
+	// A connection that delivered this much before it dropped made progress,
+	// the retries of the transfer start over
+	ProgressReset = int64(1024 * 1024)
 
-	ring_buffer "github.com/sushydev/ring_buffer_go"
+	reportInterval = int64(8 * 1024 * 1024)
 )
 
+// ErrStalled is returned for a connection that stopped delivering bytes, it
+// is a timeout like the deadline errors of the net package
+var ErrStalled = fmt.Errorf("connection stalled: %w", os.ErrDeadlineExceeded)
+
+// Metrics counts the retries and failures of all transfers
+type Metrics struct {
+	Retries  int64
+	Failures int64
+}
+
+var retries, failures atomic.Int64
+
+func GetMetrics() Metrics {
+	return Metrics{
+		Retries:  retries.Load(),
+		Failures: failures.Load(),
+	}
+}
+
+// Sources picks the source a transfer continues on after its connection
+// failed and learns how fast every source is
+type Sources interface {
+	Failover(failed connection.Source, err error) (connection.Source, error)
+	Report(source connection.Source, received int64, elapsed time.Duration)
+}
+
+// Limiter throttles the bytes a transfer receives
+type Limiter interface {
+	Wait(ctx context.Context, n int) error
+}
+
 type Transfer struct {
 	buffer     io.WriteCloser
 	connection *connection.Connection
+	sources    Sources
+	limiter    Limiter
 
 	context context.Context
 	cancel  context.CancelFunc
 
 	logger *logger.Logger
 
+	// Error the transfer gave up with
+	err error
+
 	wg *sync.WaitGroup
+	mu sync.Mutex
 
 	closed atomic.Bool
 }
@@ -32,11 +81,15 @@ var _ io.Closer = &Transfer{}
 // Buffer pool for efficient memory reuse
 var bufferPool = sync.Pool{
 	New: func() interface{} {
-		return make([]byte, 64*1024) // 64KB buffers
+		buf := make([]byte, 64*1024) // 64KB buffers
+		return &buf
 	},
 }
 
-func NewTransfer(buffer ring_buffer.LockingRingBufferInterface, connection *connection.Connection) *Transfer {
+// NewTransfer copies the connection into the buffer, sources is optional and
+// is used to continue on another source once the current one fails, limiter
+// is optional and throttles the transfer
+func NewTransfer(buffer io.WriteCloser, connection *connection.Connection, sources Sources, limiter Limiter) *Transfer {
 	logger, err := logger.NewLogger("Transfer")
 	if err != nil {
 		panic(err)
@@ -47,6 +100,8 @@ func NewTransfer(buffer ring_buffer.LockingRingBufferInterface, connection *conn
 	transfer := &Transfer{
 		buffer:     buffer,
 		connection: connection,
+		sources:    sources,
+		limiter:    limiter,
 
 		context: ctx,
 		cancel:  cancel,
@@ -56,89 +111,249 @@ func NewTransfer(buffer ring_buffer.LockingRingBufferInterface, connection *conn
 		logger: logger,
 	}
 
+	transfer.wg.Add(1)
 	go transfer.start()
 
 	return transfer
 }
 
+// start copies the connection into the buffer, a dropped connection is
+// resumed after the last received byte until the retry budget is spent. The
+// budget is only renewed by connections that made progress, a server that
+// drops every connection after a few bytes is given up on.
 func (transfer *Transfer) start() {
-	transfer.wg.Add(1)
 	defer transfer.wg.Done()
+	defer transfer.buffer.Close()
 
-	done := make(chan error, 1)
+	attempts := 0
+	expiredFailovers := 0
 
-	go transfer.copyData(done)
+	for {
+		connection_ := transfer.getConnection()
 
-	select {
-	case <-transfer.context.Done():
-		if transfer.connection != nil {
-			transfer.connection.Close()
-			transfer.connection = nil
+		received, err := transfer.copyData(connection_)
+		if received >= ProgressReset {
+			attempts = 0
+			expiredFailovers = 0
 		}
-	case err := <-done:
-		switch err {
-		case context.Canceled:
-		case nil:
+
+		source := connection_.Source()
+		expired := connection.IsExpired(err)
+
+		switch {
+		case err == nil:
+			return
+		case transfer.context.Err() != nil:
+			return
+		case strings.HasPrefix(err.Error(), "Buffer is closed"):
+			return
+		case expired && transfer.sources != nil && expiredFailovers < MaxRetries:
+			// The sources move on to another url or resolve new ones
+			expiredFailovers++
+		case !connection.IsRetryable(err):
+			transfer.fail("Error copying from connection", err)
+			return
+		case attempts >= MaxRetries:
+			transfer.fail(fmt.Sprintf("Giving up after %d retries", attempts), err)
+			return
 		default:
-			if strings.HasPrefix(err.Error(), "Buffer is closed") {
-				break
+			attempts++
+			retries.Add(1)
+		}
+
+		next := source
+
+		if transfer.sources != nil {
+			var failoverErr error
+
+			next, failoverErr = transfer.sources.Failover(source, err)
+			if failoverErr != nil {
+				transfer.fail("Failed to find a source to continue on", fmt.Errorf("%w, last error: %w", failoverErr, err))
+				return
 			}
-			transfer.logger.Error("Error copying from connection", err)
+		}
+
+		// Another source can be tried right away, the same one gets time to recover
+		if next.Url == source.Url && !expired {
+			delay := backoff(attempts)
+			transfer.logger.Warn(fmt.Sprintf("Connection dropped after %d bytes, retry %d of %d in %s: %v", received, attempts, MaxRetries, delay, err))
+
+			select {
+			case <-time.After(delay):
+			case <-transfer.context.Done():
+				return
+			}
+		}
+
+		if !transfer.resume(connection_, next, received) {
+			return
 		}
 	}
+}
+
+// backoff is the delay before the retry of the given attempt on the same source
+func backoff(attempt int) time.Duration {
+	return min(InitialBackoff<<(max(attempt, 1)-1), MaxBackoff)
+}
+
+// fail records the error the transfer gives up with
+func (transfer *Transfer) fail(message string, err error) {
+	failures.Add(1)
+	transfer.logger.Error(message, err)
 
-	transfer.buffer.Write(ring_buffer.EOFMarker)
+	transfer.mu.Lock()
+	transfer.err = err
+	transfer.mu.Unlock()
 }
 
-func (transfer *Transfer) copyData(done chan<- error) {
-	buf := bufferPool.Get().([]byte)
-	defer bufferPool.Put(&buf)
+// Err returns the error the transfer gave up with, nil while it is running
+// or when it completed or was closed
+func (transfer *Transfer) Err() error {
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	return transfer.err
+}
+
+// resume continues the range of the connection on the source after the received bytes
+func (transfer *Transfer) resume(previous *connection.Connection, source connection.Source, received int64) bool {
+	resumed, err := previous.Resume(source, received)
+	if err != nil {
+		transfer.fail("Failed to resume connection", err)
+		return false
+	}
+
+	return transfer.setConnection(resumed)
+}
+
+// copyData returns the amount of bytes copied and nil once the connection
+// reached its end, a connection whose body stalls is closed
+func (transfer *Transfer) copyData(connection_ *connection.Connection) (int64, error) {
+	// Waiting for the response is bounded by the client, the watchdog only
+	// starts once the body is read
+	err := connection_.Open()
+	if err != nil {
+		return 0, err
+	}
+
+	bufPointer := bufferPool.Get().(*[]byte)
+	defer bufferPool.Put(bufPointer)
+
+	buf := *bufPointer
+	received := int64(0)
+
+	stallTimeout := connection_.StallTimeout()
+
+	var stalled atomic.Bool
+
+	watchdog := time.AfterFunc(stallTimeout, func() {
+		stalled.Store(true)
+		connection_.Close()
+	})
+	defer watchdog.Stop()
+
+	// Throughput is measured over the time spent reading, not while the
+	// buffer is waiting for the reader
+	var unreported int64
+	var elapsed time.Duration
+
+	report := func() {
+		if transfer.sources != nil && unreported > 0 {
+			transfer.sources.Report(connection_.Source(), unreported, elapsed)
+		}
+
+		unreported = 0
+		elapsed = 0
+	}
+	defer report()
 
 	for {
-		select {
-		case <-transfer.context.Done():
-			done <- context.Canceled
-			return
-		default:
+		if transfer.context.Err() != nil {
+			return received, context.Canceled
 		}
 
-		bytesRead, readErr := transfer.connection.Read(buf)
+		watchdog.Reset(stallTimeout)
+		readStart := time.Now()
+
+		bytesRead, readErr := connection_.Read(buf)
+
+		watchdog.Stop()
+		elapsed += time.Since(readStart)
+
+		if stalled.Load() {
+			return received, fmt.Errorf("%w for %s", ErrStalled, stallTimeout)
+		}
+
+		if bytesRead > 0 && transfer.limiter != nil {
+			err := transfer.limiter.Wait(transfer.context, bytesRead)
+			if err != nil {
+				return received, context.Canceled
+			}
+		}
 
 		if bytesRead > 0 {
-			_, writeErr := transfer.buffer.Write(buf[:bytesRead])
+			written, writeErr := transfer.buffer.Write(buf[:bytesRead])
+			received += int64(written)
+			unreported += int64(written)
+
 			if writeErr != nil {
-				done <- writeErr
-				return
+				return received, writeErr
 			}
 		}
 
+		if unreported >= reportInterval {
+			report()
+		}
+
 		if readErr != nil {
 			if readErr == io.EOF {
-				done <- nil
-			} else {
-				done <- readErr
+				return received, nil
 			}
 
-			return
+			return received, readErr
 		}
 	}
 }
 
+func (transfer *Transfer) getConnection() *connection.Connection {
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	return transfer.connection
+}
+
+// setConnection replaces the connection unless the transfer was closed
+func (transfer *Transfer) setConnection(connection *connection.Connection) bool {
+	transfer.mu.Lock()
+	defer transfer.mu.Unlock()
+
+	if transfer.closed.Load() {
+		connection.Close()
+		return false
+	}
+
+	transfer.connection = connection
+
+	return true
+}
+
 func (transfer *Transfer) Close() error {
 	if !transfer.closed.CompareAndSwap(false, true) {
 		return nil // Already closed
 	}
 
-	if transfer.connection != nil {
-		err := transfer.connection.Close()
-		if err != nil {
-			fmt.Println("Error closing connection:", err)
-		}
-	}
-
+	// Cancel first so the failing connection is not mistaken for a dropped one
 	transfer.cancel()
 
+	transfer.mu.Lock()
+	err := transfer.connection.Close()
+	transfer.mu.Unlock()
+
+	if err != nil {
+		fmt.Println("Error closing connection:", err)
+	}
+
 	transfer.wg.Wait()
-	
+
 	return nil
 }
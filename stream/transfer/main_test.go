@@ -0,0 +1,342 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"fuse_video_streamer/config"
+	"fuse_video_streamer/logger"
+	"fuse_video_streamer/stream/connection"
+)
+
+func TestMain(m *testing.M) {
+	directory, err := os.MkdirTemp("", "transfer")
+	if err != nil {
+		panic(err)
+	}
+
+	logger.LogDir = filepath.Join(directory, "logs")
+
+	code := m.Run()
+
+	os.RemoveAll(directory)
+	os.Exit(code)
+}
+
+// buffer collects the bytes of a transfer, it is closed once the transfer ends
+type buffer struct {
+	data []byte
+	done chan struct{}
+	once sync.Once
+	mu   sync.Mutex
+}
+
+func newBuffer() *buffer {
+	return &buffer{done: make(chan struct{})}
+}
+
+func (buffer *buffer) Write(p []byte) (int, error) {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	buffer.data = append(buffer.data, p...)
+
+	return len(p), nil
+}
+
+func (buffer *buffer) Close() error {
+	buffer.once.Do(func() { close(buffer.done) })
+	return nil
+}
+
+func (buffer *buffer) Bytes() []byte {
+	buffer.mu.Lock()
+	defer buffer.mu.Unlock()
+
+	return buffer.data
+}
+
+func (buffer *buffer) wait(t *testing.T, timeout time.Duration) {
+	t.Helper()
+
+	select {
+	case <-buffer.done:
+	case <-time.After(timeout):
+		t.Fatalf("transfer did not end within %s", timeout)
+	}
+}
+
+func newContent(size int) []byte {
+	content := make([]byte, size)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+
+	return content
+}
+
+// stallingWriter sends the first bytes of the body and then stops sending
+// until the client gives up on the request
+type stallingWriter struct {
+	http.ResponseWriter
+	remaining int
+	ctx       context.Context
+}
+
+func (writer *stallingWriter) Write(p []byte) (int, error) {
+	if len(p) <= writer.remaining {
+		writer.remaining -= len(p)
+		return writer.ResponseWriter.Write(p)
+	}
+
+	n, _ := writer.ResponseWriter.Write(p[:writer.remaining])
+	writer.remaining = 0
+	writer.ResponseWriter.(http.Flusher).Flush()
+
+	<-writer.ctx.Done()
+
+	return n, writer.ctx.Err()
+}
+
+// server serves the content, handler can change the response of every request
+func server(t *testing.T, content []byte, handler func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter) (*httptest.Server, *atomic.Int32) {
+	var requests atomic.Int32
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := int(requests.Add(1))
+
+		if handler != nil {
+			w = handler(request, w, r)
+		}
+
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(content))
+	}))
+	t.Cleanup(server.Close)
+
+	return server, &requests
+}
+
+func newSource(t *testing.T, url string, stallTimeout time.Duration) connection.Source {
+	client, err := connection.NewClient(config.HTTP{StallTimeoutSeconds: stallTimeout.Seconds()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return connection.Source{Url: url, Client: client}
+}
+
+func startTransfer(t *testing.T, source connection.Source, sources Sources) (*Transfer, *buffer) {
+	connection_, err := connection.NewConnection(source, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buffer := newBuffer()
+
+	transfer := NewTransfer(buffer, connection_, sources, nil)
+	t.Cleanup(func() { transfer.Close() })
+
+	return transfer, buffer
+}
+
+func TestSlowResponseIsNotStalled(t *testing.T) {
+	content := newContent(256 * 1024)
+
+	server, requests := server(t, content, func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+		time.Sleep(500 * time.Millisecond)
+		return w
+	})
+
+	// Waiting for the response is bounded by the response header timeout
+	// of the client, not by the much shorter stall timeout
+	transfer, buffer := startTransfer(t, newSource(t, server.URL, 100*time.Millisecond), nil)
+	buffer.wait(t, 5*time.Second)
+
+	if err := transfer.Err(); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+
+	if requests.Load() != 1 {
+		t.Fatalf("the slow response was requested %d times", requests.Load())
+	}
+
+	if !bytes.Equal(buffer.Bytes(), content) {
+		t.Fatalf("received %d bytes that differ from the content", len(buffer.Bytes()))
+	}
+}
+
+func TestStalledBodyIsResumed(t *testing.T) {
+	content := newContent(256 * 1024)
+
+	server, requests := server(t, content, func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+		if request == 1 {
+			return &stallingWriter{ResponseWriter: w, remaining: 1000, ctx: r.Context()}
+		}
+
+		return w
+	})
+
+	transfer, buffer := startTransfer(t, newSource(t, server.URL, 200*time.Millisecond), nil)
+	buffer.wait(t, 5*time.Second)
+
+	if err := transfer.Err(); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+
+	if requests.Load() != 2 {
+		t.Fatalf("expected the stalled body to be requested again once, got %d requests", requests.Load())
+	}
+
+	if !bytes.Equal(buffer.Bytes(), content) {
+		t.Fatalf("received %d bytes that differ from the content", len(buffer.Bytes()))
+	}
+}
+
+// droppingWriter sends the first bytes of the body and then drops the connection
+type droppingWriter struct {
+	http.ResponseWriter
+	remaining int
+}
+
+func (writer *droppingWriter) Write(p []byte) (int, error) {
+	if len(p) <= writer.remaining {
+		writer.remaining -= len(p)
+		return writer.ResponseWriter.Write(p)
+	}
+
+	writer.ResponseWriter.Write(p[:writer.remaining])
+	writer.ResponseWriter.(http.Flusher).Flush()
+
+	panic(http.ErrAbortHandler)
+}
+
+// alternating fails over between two sources right away
+type alternating struct {
+	sources [2]connection.Source
+}
+
+func (alternating *alternating) Failover(failed connection.Source, err error) (connection.Source, error) {
+	if failed.Url == alternating.sources[0].Url {
+		return alternating.sources[1], nil
+	}
+
+	return alternating.sources[0], nil
+}
+
+func (alternating *alternating) Report(source connection.Source, received int64, elapsed time.Duration) {
+}
+
+func newAlternating(t *testing.T, url string) *alternating {
+	// Both sources point to the same server, the query tells them apart
+	return &alternating{sources: [2]connection.Source{
+		newSource(t, url+"?a", connection.DefaultStallTimeout),
+		newSource(t, url+"?b", connection.DefaultStallTimeout),
+	}}
+}
+
+func TestBackoff(t *testing.T) {
+	expected := []time.Duration{
+		250 * time.Millisecond,
+		500 * time.Millisecond,
+		time.Second,
+		2 * time.Second,
+		4 * time.Second,
+		MaxBackoff,
+		MaxBackoff,
+	}
+
+	for i, delay := range expected {
+		if backoff(i+1) != delay {
+			t.Errorf("retry %d waits %s, expected %s", i+1, backoff(i+1), delay)
+		}
+	}
+}
+
+func TestRetriesSameSourceWithBackoff(t *testing.T) {
+	content := newContent(256 * 1024)
+
+	server, requests := server(t, content, func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+		if request <= 2 {
+			return &droppingWriter{ResponseWriter: w, remaining: 1}
+		}
+
+		return w
+	})
+
+	start := time.Now()
+
+	transfer, buffer := startTransfer(t, newSource(t, server.URL, connection.DefaultStallTimeout), nil)
+	buffer.wait(t, 5*time.Second)
+
+	if err := transfer.Err(); err != nil {
+		t.Fatalf("transfer failed: %v", err)
+	}
+
+	if elapsed := time.Since(start); elapsed < backoff(1)+backoff(2) {
+		t.Fatalf("two retries took %s, less than their backoff", elapsed)
+	}
+
+	if requests.Load() != 3 || !bytes.Equal(buffer.Bytes(), content) {
+		t.Fatalf("received %d bytes in %d requests", len(buffer.Bytes()), requests.Load())
+	}
+}
+
+func TestGivesUpOnConnectionsDroppingEarly(t *testing.T) {
+	content := newContent(256 * 1024)
+
+	// Every connection delivers a byte, which is no progress worth retrying for
+	server, requests := server(t, content, func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+		return &droppingWriter{ResponseWriter: w, remaining: 1}
+	})
+
+	sources := newAlternating(t, server.URL)
+
+	transfer, buffer := startTransfer(t, sources.sources[0], sources)
+	buffer.wait(t, 5*time.Second)
+
+	if transfer.Err() == nil {
+		t.Fatalf("transfer did not give up")
+	}
+
+	if requests.Load() != MaxRetries+1 {
+		t.Fatalf("expected %d requests before giving up, got %d", MaxRetries+1, requests.Load())
+	}
+
+	if len(buffer.Bytes()) != MaxRetries+1 || !bytes.Equal(buffer.Bytes(), content[:MaxRetries+1]) {
+		t.Fatalf("received %d bytes that differ from the content", len(buffer.Bytes()))
+	}
+}
+
+func TestProgressRenewsRetries(t *testing.T) {
+	drop := int(ProgressReset) + 1000
+	content := newContent((MaxRetries + 3) * drop)
+
+	server, requests := server(t, content, func(request int, w http.ResponseWriter, r *http.Request) http.ResponseWriter {
+		return &droppingWriter{ResponseWriter: w, remaining: drop}
+	})
+
+	sources := newAlternating(t, server.URL)
+
+	transfer, buffer := startTransfer(t, sources.sources[0], sources)
+	buffer.wait(t, 10*time.Second)
+
+	if err := transfer.Err(); err != nil {
+		t.Fatalf("transfer failed after %d requests: %v", requests.Load(), err)
+	}
+
+	if requests.Load() <= MaxRetries+1 {
+		t.Fatalf("only %d requests were needed, the retries were not renewed", requests.Load())
+	}
+
+	if !bytes.Equal(buffer.Bytes(), content) {
+		t.Fatalf("received %d bytes that differ from the content", len(buffer.Bytes()))
+	}
+}
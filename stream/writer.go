@@ -0,0 +1,140 @@
+package stream
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+
+	"fuse_video_streamer/stream/cache"
+)
+
+// writer receives the sequential bytes of a transfer and stores them in the
+// chunks of the stream between the start and end position of the segment.
+type writer struct {
+	download *download
+	stream   *Stream
+
+	position atomic.Int64
+	end      int64
+
+	done   chan struct{}
+	closed atomic.Bool
+}
+
+var _ io.WriteCloser = &writer{}
+
+func newWriter(download *download, startPosition int64, endPosition int64) *writer {
+	writer := &writer{
+		download: download,
+		stream:   download.stream,
+
+		end: endPosition,
+
+		done: make(chan struct{}),
+	}
+
+	writer.position.Store(startPosition)
+
+	return writer
+}
+
+func (writer *writer) Position() int64 {
+	return writer.position.Load()
+}
+
+func (writer *writer) Write(p []byte) (int, error) {
+	written := 0
+
+	for written < len(p) {
+		if writer.isClosed() || writer.download.isClosed() || writer.stream.isChanged() {
+			return written, fmt.Errorf("Buffer is closed")
+		}
+
+		position := writer.Position()
+		if position >= writer.end {
+			return len(p), nil
+		}
+
+		if !writer.waitForReader(position) {
+			continue
+		}
+
+		chunkSize := writer.stream.cache.ChunkSize()
+		index := position / chunkSize
+		offset := position - index*chunkSize
+
+		chunk := writer.stream.getOrCreateChunk(index)
+		wasComplete := chunk.IsComplete()
+
+		consumed := chunk.WriteAt(p[written:min(len(p), written+int(writer.end-position))], offset)
+		if consumed == 0 {
+			// The chunk was recreated by another writer and is filled up to an
+			// earlier offset, the bytes can not be stored so they are skipped
+			consumed = int(min(int64(len(p)-written), chunk.Len()-offset, writer.end-position))
+		}
+
+		if !wasComplete && chunk.IsComplete() && !writer.stream.isChanged() {
+			writer.stream.cache.Persist(writer.stream.chunkKey(index), chunk)
+		}
+
+		written += consumed
+		writer.position.Add(int64(consumed))
+		writer.download.received.Add(int64(consumed))
+
+		writer.stream.broadcast()
+	}
+
+	return written, nil
+}
+
+func (writer *writer) Close() error {
+	if !writer.closed.CompareAndSwap(false, true) {
+		return nil
+	}
+
+	close(writer.done)
+
+	writer.stream.broadcast()
+
+	return nil
+}
+
+func (writer *writer) isClosed() bool {
+	return writer.closed.Load()
+}
+
+// waitForReader blocks the writer while it is too far ahead of the last read
+func (writer *writer) waitForReader(position int64) bool {
+	lookahead := writer.stream.lookahead()
+
+	for !writer.isClosed() && !writer.download.isClosed() {
+		notify := writer.stream.getNotify()
+
+		if position < writer.download.readPosition.Load()+lookahead {
+			return true
+		}
+
+		writer.download.stalled.Store(true)
+
+		select {
+		case <-notify:
+		case <-writer.download.ctx.Done():
+		}
+	}
+
+	return false
+}
+
+func (stream *Stream) getOrCreateChunk(index int64) *cache.Chunk {
+	key := stream.chunkKey(index)
+
+	chunk := stream.cache.Get(key)
+	if chunk != nil {
+		return chunk
+	}
+
+	chunkSize := stream.cache.ChunkSize()
+	chunk = cache.NewChunk(min(chunkSize, stream.size-index*chunkSize))
+
+	return stream.cache.GetOrPut(key, chunk)
+}